@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// externalBaseURL returns the scheme and host clients used to reach the
+// service, such as "https://api.example.com", for building absolute URLs.
+// Behind a reverse proxy that terminates TLS or rewrites the host, the
+// connection seen here is not the one the client made, so X-Forwarded-Proto
+// and X-Forwarded-Host from a trusted proxy take precedence over r.TLS and
+// r.Host. Only the last value of each is used, the one set by the trusted
+// proxy nearest this service: earlier values may come from the client.
+func (s *Server) externalBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if peer, err := peerAddr(r); err != nil || !s.config.trustsProxy(peer) {
+		return scheme + "://" + r.Host
+	}
+	if proto := strings.ToLower(lastForwardedValue(r.Header.Values("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwarded := lastForwardedValue(r.Header.Values("X-Forwarded-Host")); forwarded != "" {
+		host = forwarded
+	}
+
+	return scheme + "://" + host
+}
+
+// lastForwardedValue returns the last non-empty entry of a comma-separated
+// X-Forwarded-* header, walking it from the right as clientAddr does.
+func lastForwardedValue(values []string) string {
+	entries := strings.Split(strings.Join(values, ","), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entry := strings.TrimSpace(entries[i]); entry != "" {
+			return entry
+		}
+	}
+	return ""
+}
+
+// canonicalTemperatureURL is the absolute URL of the /temperature answer to
+// r, with the CEP in its normalized form and the query sorted, sent as
+// Content-Location so clients and caches can tell equivalent lookups apart.
+func (s *Server) canonicalTemperatureURL(r *http.Request, cep string) string {
+	query := r.URL.Query()
+	if cep != "" {
+		query.Set("cep", cep)
+	}
+	return s.externalBaseURL(r) + r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+  "crypto/tls"
+  "net/http"
+  "net/http/httptest"
+  "net/netip"
+  "testing"
+)
+
+// trustedProxyConfig trusts the RemoteAddr httptest.NewRequest assigns.
+func trustedProxyConfig() Config {
+  cfg := testConfig()
+  cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+  return cfg
+}
+
+func TestExternalBaseURL(t *testing.T) {
+  tests := []struct {
+    name     string
+    tls      bool
+    headers  map[string]string
+    expected string
+  }{
+    {"Direct HTTP", false, nil, "http://internal:8080"},
+    {"Direct TLS", true, nil, "https://internal:8080"},
+    {
+      "Forwarded proto and host",
+      false,
+      map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"},
+      "https://api.example.com",
+    },
+    {
+      "Nearest of several values",
+      false,
+      map[string]string{"X-Forwarded-Proto": "http, HTTPS", "X-Forwarded-Host": "evil.example, api.example.com"},
+      "https://api.example.com",
+    },
+    {"Trailing empty value", false, map[string]string{"X-Forwarded-Host": "api.example.com, "}, "http://api.example.com"},
+    {"Forwarded proto only", false, map[string]string{"X-Forwarded-Proto": "https"}, "https://internal:8080"},
+    {"Unknown proto ignored", true, map[string]string{"X-Forwarded-Proto": "gopher"}, "https://internal:8080"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "http://internal:8080/temperature", nil)
+      if tt.tls {
+        req.TLS = &tls.ConnectionState{}
+      }
+      for key, value := range tt.headers {
+        req.Header.Set(key, value)
+      }
+
+      if got := NewServer(trustedProxyConfig(), nil).externalBaseURL(req); got != tt.expected {
+        t.Errorf("Expected %q, got %q", tt.expected, got)
+      }
+    })
+  }
+}
+
+func TestExternalBaseURLUntrustedPeer(t *testing.T) {
+  req := httptest.NewRequest("GET", "http://internal:8080/temperature", nil)
+  req.RemoteAddr = "203.0.113.9:51234"
+  req.Header.Set("X-Forwarded-Proto", "https")
+  req.Header.Set("X-Forwarded-Host", "evil.example.com")
+
+  if got, expected := NewServer(trustedProxyConfig(), nil).externalBaseURL(req), "http://internal:8080"; got != expected {
+    t.Errorf("Expected forwarded headers from an untrusted peer to be ignored: want %q, got %q", expected, got)
+  }
+}
+
+func TestTemperatureHandlerContentLocation(t *testing.T) {
+  s := NewServer(trustedProxyConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, `{"localidade": "São Paulo", "uf": "SP"}`), nil
+    }
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0}}`), nil
+  }))
+
+  tests := []struct {
+    name     string
+    headers  map[string]string
+    expected string
+  }{
+    {"Direct connection", nil, "http://localhost:8080/temperature?cep=01001000&units=C"},
+    {
+      "Behind proxy",
+      map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"},
+      "https://api.example.com/temperature?cep=01001000&units=C",
+    },
+    {
+      "Spoofed host",
+      map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example, api.example.com"},
+      "https://api.example.com/temperature?cep=01001000&units=C",
+    },
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "http://localhost:8080/temperature?units=C&cep=01001-000", nil)
+      for key, value := range tt.headers {
+        req.Header.Set(key, value)
+      }
+      rr := httptest.NewRecorder()
+      s.temperatureHandler(rr, req)
+
+      if rr.Code != http.StatusOK {
+        t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+      }
+      if got := rr.Header().Get("Content-Location"); got != tt.expected {
+        t.Errorf("Expected Content-Location %q, got %q", tt.expected, got)
+      }
+    })
+  }
+}
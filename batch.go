@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+const (
+	maxBatchCEPs = 50
+	batchWorkers = 5
+
+	defaultMaxBodyBytes = 1 << 20
+)
+
+type BatchTemperatureRequest struct {
+	CEPs []string `json:"ceps"`
+}
+
+// BatchTemperatureResult is the outcome for one CEP of a batch request:
+// either Temperature or Error is set, and Status mirrors what
+// /temperature would have returned for that CEP.
+type BatchTemperatureResult struct {
+	CEP         string               `json:"cep"`
+	Status      int                  `json:"status"`
+	Temperature *TemperatureResponse `json:"temperature,omitempty"`
+	Error       *ErrorResponse       `json:"error,omitempty"`
+}
+
+func (s *Server) batchTemperatureHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFromRequest(r)
+	w.Header().Set(requestIDHeader, requestID)
+	ctx := withRequestID(r.Context(), requestID)
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+
+	var request BatchTemperatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			responseWithError(w, r, http.StatusRequestEntityTooLarge, msgBodyTooLarge)
+			return
+		}
+		responseWithError(w, r, http.StatusBadRequest, msgInvalidBody)
+		return
+	}
+
+	if len(request.CEPs) == 0 {
+		responseWithError(w, r, http.StatusBadRequest, msgCEPsRequired)
+		return
+	}
+
+	if len(request.CEPs) > maxBatchCEPs {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgTooManyCEPs)
+		return
+	}
+
+	results := make([]BatchTemperatureResult, len(request.CEPs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(request.CEPs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = s.resolveBatchCEP(ctx, request.CEPs[i])
+			}
+		}()
+	}
+
+	for i := range request.CEPs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Per-CEP errors are translated like responseWithError's.
+	lang := errorLanguageFromRequest(r)
+	for i := range results {
+		if results[i].Error != nil {
+			results[i].Error.Message = translateError(lang, results[i].Error.Message)
+		}
+	}
+
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *Server) resolveBatchCEP(ctx context.Context, rawCEP string) BatchTemperatureResult {
+	cep := normalizeCEP(rawCEP)
+	result := BatchTemperatureResult{CEP: cep}
+
+	if err := validateCEP(cep); err != nil {
+		result.Status = http.StatusUnprocessableEntity
+		result.Error = &ErrorResponse{Message: err.Error()}
+		return result
+	}
+
+	response, err := s.fetchTemperature(ctx, cep, "")
+	if err != nil {
+		result.Status = http.StatusInternalServerError
+		result.Error = &ErrorResponse{Message: msgTemperatureFailed}
+
+		var tempErr *temperatureError
+		if errors.As(err, &tempErr) {
+			result.Status = tempErr.Status
+			result.Error.Message = tempErr.Message
+		}
+		return result
+	}
+
+	response.Conditions = nil
+	response.Location = nil
+	response.units = s.defaultUnits()
+	result.Status = http.StatusOK
+	result.Temperature = response
+	return result
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestBatchTemperatureHandler(t *testing.T) {
+  cities := map[string]string{"01001000": "Recife", "20040002": "Curitiba", "30130010": "Natal"}
+  temperatures := map[string]float64{"Recife": 30.0, "Curitiba": 15.0, "Natal": 28.0}
+
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      for cep, city := range cities {
+        if strings.Contains(req.URL.Path, cep) {
+          return mockResponse(http.StatusOK, fmt.Sprintf(`{"cep": %q, "localidade": %q}`, cep, city)), nil
+        }
+      }
+      return mockResponse(http.StatusOK, `{"erro": true}`), nil
+    }
+    if req.URL.Host == "brasilapi.com.br" {
+      return mockResponse(http.StatusNotFound, `{}`), nil
+    }
+    city := req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, fmt.Sprintf(`{"current": {"temp_c": %v}}`, temperatures[city])), nil
+  }))
+
+  body := `{"ceps": ["01001000", "20040002", "123", "99999999", "30130-010"]}`
+  req, err := http.NewRequest("POST", "/temperature/batch", strings.NewReader(body))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.batchTemperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  var results []BatchTemperatureResult
+  if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  expected := []struct {
+    cep    string
+    status int
+    city   string
+    tempC  float64
+  }{
+    {"01001000", http.StatusOK, "Recife", 30.0},
+    {"20040002", http.StatusOK, "Curitiba", 15.0},
+    {"123", http.StatusUnprocessableEntity, "", 0},
+    {"99999999", http.StatusNotFound, "", 0},
+    {"30130010", http.StatusOK, "Natal", 28.0},
+  }
+
+  if len(results) != len(expected) {
+    t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+  }
+
+  for i, want := range expected {
+    got := results[i]
+    if got.CEP != want.cep || got.Status != want.status {
+      t.Errorf("result %d: expected cep %s status %d, got cep %s status %d", i, want.cep, want.status, got.CEP, got.Status)
+      continue
+    }
+
+    if want.status != http.StatusOK {
+      if got.Error == nil || got.Error.Message == "" {
+        t.Errorf("result %d: expected an error message, got %+v", i, got)
+      }
+      continue
+    }
+
+    if got.Temperature == nil {
+      t.Errorf("result %d: expected a temperature, got none", i)
+      continue
+    }
+
+    if got.Temperature.City != want.city || got.Temperature.TempC != want.tempC {
+      t.Errorf("result %d: expected %s at %v C, got %s at %v C", i, want.city, want.tempC, got.Temperature.City, got.Temperature.TempC)
+    }
+  }
+}
+
+func TestBatchTemperatureHandlerTooManyCEPs(t *testing.T) {
+  ceps := make([]string, maxBatchCEPs+1)
+  for i := range ceps {
+    ceps[i] = "01001000"
+  }
+  body, err := json.Marshal(BatchTemperatureRequest{CEPs: ceps})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  req, err := http.NewRequest("POST", "/temperature/batch", strings.NewReader(string(body)))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).batchTemperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+}
+
+func TestBatchTemperatureHandlerInvalidBody(t *testing.T) {
+  req, err := http.NewRequest("POST", "/temperature/batch", strings.NewReader("not json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).batchTemperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusBadRequest {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+  }
+}
+
+func TestBatchTemperatureHandlerBodyTooLarge(t *testing.T) {
+  cfg := testConfig()
+  cfg.MaxBodyBytes = 64
+  s := NewServer(cfg, nil)
+
+  body := `{"ceps": ["` + strings.Repeat("0", 128) + `"]}`
+  req, err := http.NewRequest("POST", "/temperature/batch", strings.NewReader(body))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.batchTemperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+  if response.Message != "corpo da requisição grande demais" {
+    t.Errorf("Expected message %q, got %q", "corpo da requisição grande demais", response.Message)
+  }
+}
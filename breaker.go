@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops calling a failing dependency after threshold
+// consecutive failures. Once cooldown has elapsed a single trial call is let
+// through (half-open): success closes the breaker, failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	clock     Clock
+
+	// isFailure decides which errors count against the breaker; nil
+	// counts every error.
+	isFailure func(err error) bool
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     realClock{},
+	}
+}
+
+// newWeatherBreaker returns a breaker that ignores unknown-location errors
+// and calls rejected by upstreamSlots, which say nothing about WeatherAPI's
+// health.
+func newWeatherBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	breaker := newCircuitBreaker(threshold, cooldown)
+	breaker.isFailure = func(err error) bool {
+		return !isWeatherLocationNotFound(err) && !errors.Is(err, errUpstreamBusy)
+	}
+	return breaker
+}
+
+// call runs fn unless the breaker is open, in which case it fails fast with
+// errCircuitOpen. A call that fails because ctx was cancelled or ran out of
+// time, e.g. the client went away, is not held against the upstream.
+func (b *circuitBreaker) call(ctx context.Context, fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	if err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil) {
+		b.abandon()
+		return err
+	}
+	b.record(err)
+	return err
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		// A trial call is already in flight
+		return errCircuitOpen
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || (b.isFailure != nil && !b.isFailure(err)) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// abandon records a call whose outcome says nothing about the upstream. An
+// abandoned trial call puts the breaker back to open, so the next call is
+// let through as a new trial.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+// retryAfter is how long until the breaker lets a trial call through: the
+// rest of the cooldown while open, or a whole cooldown if the trial call
+// fails.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if remaining := b.cooldown - b.clock.Now().Sub(b.openedAt); remaining > 0 {
+			return remaining
+		}
+		return 0
+	}
+	return b.cooldown
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strconv"
+  "testing"
+  "time"
+)
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+  clock := &fakeClock{now: time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)}
+  breaker := newCircuitBreaker(3, time.Minute)
+  breaker.clock = clock
+
+  calls := 0
+  failing := func() error {
+    calls++
+    return errors.New("upstream unavailable")
+  }
+  succeeding := func() error {
+    calls++
+    return nil
+  }
+
+  // Consecutive failures up to the threshold open the breaker
+  for i := 0; i < 3; i++ {
+    if err := breaker.call(context.Background(), failing); err == nil || errors.Is(err, errCircuitOpen) {
+      t.Fatalf("call %d: expected the upstream error, got %v", i, err)
+    }
+  }
+
+  if state := breaker.state; state != breakerOpen {
+    t.Fatalf("Expected breaker to be open, got %v", state)
+  }
+
+  // While open, calls fail fast without reaching the upstream
+  if err := breaker.call(context.Background(), succeeding); !errors.Is(err, errCircuitOpen) {
+    t.Errorf("Expected errCircuitOpen, got %v", err)
+  }
+  if calls != 3 {
+    t.Errorf("Expected no upstream call while open, got %d calls", calls)
+  }
+
+  // After the cool-down a failed trial call reopens the breaker
+  clock.advance(time.Minute)
+  if err := breaker.call(context.Background(), failing); err == nil || errors.Is(err, errCircuitOpen) {
+    t.Errorf("Expected the trial call to reach the upstream, got %v", err)
+  }
+  if state := breaker.state; state != breakerOpen {
+    t.Errorf("Expected breaker to reopen after a failed trial, got %v", state)
+  }
+
+  // A successful trial call closes it again
+  clock.advance(time.Minute)
+  if err := breaker.call(context.Background(), succeeding); err != nil {
+    t.Errorf("Expected trial call to succeed, got %v", err)
+  }
+  if state := breaker.state; state != breakerClosed {
+    t.Errorf("Expected breaker to be closed, got %v", state)
+  }
+}
+
+func TestCircuitBreakerResetsOnSuccess(t *testing.T) {
+  breaker := newCircuitBreaker(2, time.Minute)
+
+  breaker.call(context.Background(), func() error { return errors.New("boom") })
+  breaker.call(context.Background(), func() error { return nil })
+  breaker.call(context.Background(), func() error { return errors.New("boom") })
+
+  if state := breaker.state; state != breakerClosed {
+    t.Errorf("Expected non-consecutive failures to keep the breaker closed, got %v", state)
+  }
+}
+
+func TestTemperatureHandlerCircuitOpen(t *testing.T) {
+  cfg := testConfig()
+  cfg.BreakerThreshold = 1
+  cfg.BreakerCooldown = time.Minute
+
+  weatherCalls := 0
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    weatherCalls++
+    return mockResponse(http.StatusBadRequest, `{}`), nil
+  }))
+
+  var rr *httptest.ResponseRecorder
+  for i, expected := range []int{http.StatusBadGateway, http.StatusServiceUnavailable} {
+    req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    rr = httptest.NewRecorder()
+    http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+    if status := rr.Code; status != expected {
+      t.Errorf("request %d: handler returned wrong status code: got %v want %v", i, status, expected)
+    }
+  }
+
+  if weatherCalls != 1 {
+    t.Errorf("Expected WeatherAPI to be called once before the breaker opened, got %d", weatherCalls)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "serviço de clima temporariamente indisponível"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+
+  retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+  if err != nil || retryAfter < 1 || retryAfter > 60 {
+    t.Errorf("Expected Retry-After within the one minute cooldown, got %q", rr.Header().Get("Retry-After"))
+  }
+}
+
+func TestCircuitBreakerRetryAfter(t *testing.T) {
+  clock := &fakeClock{now: time.Now()}
+  breaker := newCircuitBreaker(1, 30*time.Second)
+  breaker.clock = clock
+
+  breaker.call(context.Background(), func() error { return errors.New("boom") })
+
+  clock.advance(10 * time.Second)
+  if got := breaker.retryAfter(); got != 20*time.Second {
+    t.Errorf("Expected 20s until the trial call, got %v", got)
+  }
+}
+
+func TestWeatherBreakerIgnoresUnknownLocations(t *testing.T) {
+  breaker := newWeatherBreaker(1, time.Minute)
+
+  breaker.call(context.Background(), func() error {
+    return &WeatherAPIError{StatusCode: http.StatusBadRequest, Code: weatherAPINoMatchingLocation}
+  })
+
+  if state := breaker.state; state != breakerClosed {
+    t.Errorf("Expected an unknown location not to open the breaker, got %v", state)
+  }
+}
+
+func TestWeatherBreakerIgnoresCancelledCalls(t *testing.T) {
+  breaker := newWeatherBreaker(2, time.Minute)
+
+  cancelled, cancel := context.WithCancel(context.Background())
+  cancel()
+  expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+  defer cancelExpired()
+
+  for i := 0; i < 2; i++ {
+    breaker.call(cancelled, func() error { return cancelled.Err() })
+    breaker.call(expired, func() error { return expired.Err() })
+    breaker.call(context.Background(), func() error { return fmt.Errorf("fetch: %w", context.Canceled) })
+  }
+  if state := breaker.state; state != breakerClosed {
+    t.Errorf("Expected cancelled calls not to open the breaker, got %v", state)
+  }
+
+  // A deadline that isn't the caller's, like the HTTP client timeout, is an
+  // upstream failure
+  for i := 0; i < 2; i++ {
+    breaker.call(context.Background(), func() error { return context.DeadlineExceeded })
+  }
+  if state := breaker.state; state != breakerOpen {
+    t.Errorf("Expected upstream timeouts to open the breaker, got %v", state)
+  }
+}
+
+func TestCircuitBreakerAbandonedTrialReopens(t *testing.T) {
+  clock := &fakeClock{now: time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)}
+  breaker := newCircuitBreaker(1, time.Minute)
+  breaker.clock = clock
+
+  breaker.call(context.Background(), func() error { return errors.New("boom") })
+  clock.advance(time.Minute)
+
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+  breaker.call(ctx, func() error { return ctx.Err() })
+  if state := breaker.state; state != breakerOpen {
+    t.Fatalf("Expected an abandoned trial to leave the breaker open, got %v", state)
+  }
+
+  // The next call is let through as a new trial
+  if err := breaker.call(context.Background(), func() error { return nil }); err != nil {
+    t.Errorf("Expected a new trial call, got %v", err)
+  }
+  if state := breaker.state; state != breakerClosed {
+    t.Errorf("Expected the breaker to close, got %v", state)
+  }
+}
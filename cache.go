@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultWeatherCacheTTL = 120 * time.Second
+
+// ttlCache keeps values per key for ttl and collapses concurrent lookups of
+// the same uncached key into a single upstream call. A ttl of zero or less
+// disables caching but keeps the collapsing.
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	clock   Clock
+	entries map[string]ttlCacheEntry[V]
+	group   singleflight.Group
+
+	// fetchTimeout bounds a shared fetch, which runs detached from the
+	// caller that started it; see get. NewServer sets it to
+	// REQUEST_TIMEOUT.
+	fetchTimeout time.Duration
+
+	hits, misses atomic.Int64
+}
+
+type ttlCacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:          ttl,
+		clock:        realClock{},
+		entries:      make(map[string]ttlCacheEntry[V]),
+		fetchTimeout: defaultRequestTimeout,
+	}
+}
+
+// newWeatherCache returns a cache of WeatherAPI responses keyed by
+// weatherCacheKey.
+func newWeatherCache(ttl time.Duration) *ttlCache[*WeatherAPIResponse] {
+	return newTTLCache[*WeatherAPIResponse](ttl)
+}
+
+// cacheFetches counts upstream fetches whose result is about to be stored
+// in a cache, so a graceful shutdown can let them finish; see
+// waitForCacheFetches.
+var cacheFetches fetchTracker
+
+// fetchTracker is a counter of in-flight fetches that can be waited on with a
+// deadline. Unlike a sync.WaitGroup, it may be reused after a wait gives up
+// while fetches are still running.
+type fetchTracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+func (t *fetchTracker) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+}
+
+func (t *fetchTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// wait blocks until no fetch is in flight or ctx ends, returning ctx's error
+// in the latter case.
+func (t *fetchTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForCacheFetches blocks until the in-flight cache fetches are done or
+// ctx ends, returning ctx's error in the latter case.
+func waitForCacheFetches(ctx context.Context) error {
+	return cacheFetches.wait(ctx)
+}
+
+type cacheBypassKey struct{}
+
+// withCacheBypass marks ctx so lookups skip the location and weather caches
+// while still storing what they fetch. It backs ?nocache=true.
+func withCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// weatherCacheKey identifies a lookup by city and condition language,
+// ignoring case and extra whitespace in the city.
+func weatherCacheKey(city, lang string) string {
+	return strings.ToLower(normalizeCity(city)) + "|" + lang
+}
+
+// get returns the cached value for key, calling fetch on a miss, and
+// reports whether the cache served it. Callers that waited on another
+// caller's fetch count as a miss. Errors are never cached.
+//
+// Concurrent misses for key share one fetch, which runs on a copy of ctx
+// that keeps its values but not its cancellation, bounded by fetchTimeout:
+// the caller that started it giving up must not fail the others waiting on
+// it. Each caller still returns as soon as its own ctx ends.
+func (c *ttlCache[V]) get(ctx context.Context, key string, fetch func(context.Context) (V, error)) (V, bool, error) {
+	var zero V
+	if value, ok := c.lookup(key); ok {
+		c.hits.Add(1)
+		return value, true, nil
+	}
+
+	hit := false
+	result := c.group.DoChan(key, func() (interface{}, error) {
+		if value, ok := c.lookup(key); ok {
+			hit = true
+			return value, nil
+		}
+
+		cacheFetches.start()
+		defer cacheFetches.done()
+
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.fetchTimeout)
+		defer cancel()
+		value, err := fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, value)
+		return value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		c.misses.Add(1)
+		return zero, false, ctx.Err()
+	case res := <-result:
+		if hit {
+			c.hits.Add(1)
+		} else {
+			c.misses.Add(1)
+		}
+		if res.Err != nil {
+			return zero, false, res.Err
+		}
+		return res.Val.(V), hit, nil
+	}
+}
+
+// refresh calls fetch without consulting the cache and stores the result.
+func (c *ttlCache[V]) refresh(ctx context.Context, key string, fetch func(context.Context) (V, error)) (V, error) {
+	cacheFetches.start()
+	defer cacheFetches.done()
+
+	value, err := fetch(ctx)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	c.store(key, value)
+	return value, nil
+}
+
+// lookup returns the cached value for key, evicting it once expired.
+func (c *ttlCache[V]) lookup(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !c.clock.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// sweep deletes the expired entries and returns how many it removed.
+func (c *ttlCache[V]) sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	removed := 0
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// stats reports the lookups counted by get and the entries held, expired
+// ones included until they are evicted.
+func (c *ttlCache[V]) stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+func (c *ttlCache[V]) store(key string, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = ttlCacheEntry[V]{value: value, expiresAt: c.clock.Now().Add(c.ttl)}
+}
+
+const defaultLocationCacheTTL = 24 * time.Hour
+
+// newLocationCache returns a cache of resolved CEPs keyed by normalized CEP.
+// Addresses change far less often than the weather, so its ttl is usually
+// much longer than the weather cache's.
+func newLocationCache(ttl time.Duration) *ttlCache[*ViaCEPResponse] {
+	return newTTLCache[*ViaCEPResponse](ttl)
+}
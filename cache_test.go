@@ -0,0 +1,390 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+func TestWeatherCacheHit(t *testing.T) {
+  cache := newWeatherCache(time.Minute)
+
+  calls := 0
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    calls++
+    weather := &WeatherAPIResponse{}
+    weather.Current.TempC = 25.0
+    return weather, nil
+  }
+
+  for i := 0; i < 3; i++ {
+    weather, hit, err := cache.get(context.Background(), weatherCacheKey("São Paulo", ""), fetch)
+    if err != nil {
+      t.Fatalf("Expected no error, got %v", err)
+    }
+    if hit != (i > 0) {
+      t.Errorf("call %d: expected hit %v, got %v", i, i > 0, hit)
+    }
+    if weather.Current.TempC != 25.0 {
+      t.Errorf("Expected cached temperature 25.0, got %v", weather.Current.TempC)
+    }
+  }
+
+  if _, _, err := cache.get(context.Background(), weatherCacheKey(" são paulo ", ""), fetch); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if calls != 1 {
+    t.Errorf("Expected a single upstream fetch, got %d", calls)
+  }
+}
+
+// fakeClock is a Clock that only moves when advance is called.
+type fakeClock struct {
+  now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestWeatherCacheExpiry(t *testing.T) {
+  clock := &fakeClock{now: time.Now()}
+  cache := newWeatherCache(time.Minute)
+  cache.clock = clock
+
+  calls := 0
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    calls++
+    return &WeatherAPIResponse{}, nil
+  }
+
+  cache.get(context.Background(), "Curitiba", fetch)
+  clock.advance(59 * time.Second)
+  cache.get(context.Background(), "Curitiba", fetch)
+  if calls != 1 {
+    t.Errorf("Expected entry to be served from cache before the TTL, got %d fetches", calls)
+  }
+
+  clock.advance(time.Second)
+  cache.get(context.Background(), "Curitiba", fetch)
+  if calls != 2 {
+    t.Errorf("Expected entry to be refetched after the TTL, got %d fetches", calls)
+  }
+}
+
+func TestLocationCacheExpiry(t *testing.T) {
+  clock := &fakeClock{now: time.Now()}
+  cache := newLocationCache(time.Hour)
+  cache.clock = clock
+
+  calls := 0
+  fetch := func(context.Context) (*ViaCEPResponse, error) {
+    calls++
+    return &ViaCEPResponse{Localidade: "São Paulo"}, nil
+  }
+
+  cache.get(context.Background(), "01001000", fetch)
+  clock.advance(time.Hour - time.Nanosecond)
+  if _, ok := cache.lookup("01001000"); !ok {
+    t.Errorf("Expected entry to be cached before the TTL")
+  }
+
+  clock.advance(time.Nanosecond)
+  if _, ok := cache.lookup("01001000"); ok {
+    t.Errorf("Expected entry to expire at the TTL")
+  }
+
+  cache.get(context.Background(), "01001000", fetch)
+  if calls != 2 {
+    t.Errorf("Expected entry to be refetched after the TTL, got %d fetches", calls)
+  }
+}
+
+func TestWeatherCacheDoesNotCacheErrors(t *testing.T) {
+  cache := newWeatherCache(time.Minute)
+
+  calls := 0
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    calls++
+    return nil, errors.New("upstream unavailable")
+  }
+
+  for i := 0; i < 2; i++ {
+    if _, _, err := cache.get(context.Background(), "Recife", fetch); err == nil {
+      t.Errorf("Expected error, got nil")
+    }
+  }
+
+  if calls != 2 {
+    t.Errorf("Expected errors not to be cached, got %d fetches", calls)
+  }
+}
+
+func TestWeatherCacheSingleFlight(t *testing.T) {
+  cache := newWeatherCache(time.Minute)
+
+  var calls int32
+  release := make(chan struct{})
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    atomic.AddInt32(&calls, 1)
+    <-release
+    return &WeatherAPIResponse{}, nil
+  }
+
+  const callers = 10
+  var started, done sync.WaitGroup
+  started.Add(callers)
+  done.Add(callers)
+  for i := 0; i < callers; i++ {
+    go func() {
+      defer done.Done()
+      started.Done()
+      if _, _, err := cache.get(context.Background(), "Salvador", fetch); err != nil {
+        t.Errorf("Expected no error, got %v", err)
+      }
+    }()
+  }
+
+  started.Wait()
+  // Give the callers time to queue up behind the in-flight fetch.
+  time.Sleep(20 * time.Millisecond)
+  close(release)
+  done.Wait()
+
+  if got := atomic.LoadInt32(&calls); got != 1 {
+    t.Errorf("Expected a single upstream fetch for concurrent callers, got %d", got)
+  }
+}
+
+func TestWeatherCacheLeaderCancelDoesNotFailFollowers(t *testing.T) {
+  cache := newWeatherCache(time.Minute)
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  fetch := func(ctx context.Context) (*WeatherAPIResponse, error) {
+    close(started)
+    <-release
+    if err := ctx.Err(); err != nil {
+      return nil, err
+    }
+    return &WeatherAPIResponse{}, nil
+  }
+
+  leaderCtx, cancel := context.WithCancel(context.Background())
+  leaderErr := make(chan error, 1)
+  go func() {
+    _, _, err := cache.get(leaderCtx, "Fortaleza", fetch)
+    leaderErr <- err
+  }()
+  <-started
+
+  followerErr := make(chan error, 1)
+  go func() {
+    _, _, err := cache.get(context.Background(), "Fortaleza", fetch)
+    followerErr <- err
+  }()
+  // Give the follower time to queue up behind the in-flight fetch.
+  time.Sleep(20 * time.Millisecond)
+
+  cancel()
+  select {
+  case err := <-leaderErr:
+    if !errors.Is(err, context.Canceled) {
+      t.Errorf("Expected the leader to get %v, got %v", context.Canceled, err)
+    }
+  case <-time.After(time.Second):
+    t.Fatal("Expected the leader to return once its context was cancelled")
+  }
+
+  close(release)
+  if err := <-followerErr; err != nil {
+    t.Errorf("Expected the follower to get the shared result, got %v", err)
+  }
+  if _, ok := cache.lookup("Fortaleza"); !ok {
+    t.Error("Expected the shared fetch to be cached")
+  }
+}
+
+func TestTemperatureHandlerUsesWeatherCache(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherCacheTTL = time.Minute
+
+  weatherCalls := 0
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    weatherCalls++
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  for i := 0; i < 2; i++ {
+    req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+    if status := rr.Code; status != http.StatusOK {
+      t.Errorf("request %d: handler returned wrong status code: got %v want %v", i, status, http.StatusOK)
+    }
+  }
+
+  if weatherCalls != 1 {
+    t.Errorf("Expected WeatherAPI to be called once, got %d", weatherCalls)
+  }
+}
+
+func TestTemperatureHandlerReportsCacheStatus(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherCacheTTL = time.Minute
+
+  s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  for i, expected := range []string{"MISS", "HIT"} {
+    req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+    if status := rr.Code; status != http.StatusOK {
+      t.Fatalf("request %d: handler returned wrong status code: got %v want %v", i, status, http.StatusOK)
+    }
+    if got := rr.Header().Get("X-Cache"); got != expected {
+      t.Errorf("request %d: expected X-Cache %q, got %q", i, expected, got)
+    }
+  }
+}
+
+func TestTemperatureHandlerNoCache(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherCacheTTL = time.Minute
+  cfg.LocationCacheTTL = time.Hour
+
+  calls := map[string]int{}
+  temp := 25.0
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls[req.URL.Host]++
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, fmt.Sprintf(`{"location": {"name": "São Paulo"}, "current": {"temp_c": %v}}`, temp)), nil
+  }))
+
+  get := func(url string) *httptest.ResponseRecorder {
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+      t.Fatal(err)
+    }
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+    if status := rr.Code; status != http.StatusOK {
+      t.Fatalf("%s: handler returned wrong status code: got %v want %v", url, status, http.StatusOK)
+    }
+    return rr
+  }
+
+  get("/temperature?cep=01001000")
+  temp = 30.0
+
+  rr := get("/temperature?cep=01001000&nocache=true")
+  if calls["viacep.com.br"] != 2 || calls["api.weatherapi.com"] != 2 {
+    t.Errorf("Expected nocache to call ViaCEP and WeatherAPI again, got %v", calls)
+  }
+  if got := rr.Header().Get("X-Cache"); got != "MISS" {
+    t.Errorf("Expected X-Cache MISS, got %q", got)
+  }
+  if !strings.Contains(rr.Body.String(), `"temp_C":30`) {
+    t.Errorf("Expected the fresh reading, got %s", rr.Body.String())
+  }
+
+  // The fresh reading replaces the cached one for later requests.
+  rr = get("/temperature?cep=01001000")
+  if calls["viacep.com.br"] != 2 || calls["api.weatherapi.com"] != 2 {
+    t.Errorf("Expected the next request to be served from cache, got %v", calls)
+  }
+  if !strings.Contains(rr.Body.String(), `"temp_C":30`) {
+    t.Errorf("Expected the refreshed cache entry, got %s", rr.Body.String())
+  }
+}
+
+func TestTemperatureHandlerInvalidNoCache(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&nocache=maybe", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+}
+
+func TestTemperatureHandlerCollapsesConcurrentRequests(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherCacheTTL = time.Minute
+  cfg.LocationCacheTTL = time.Minute
+
+  var mu sync.Mutex
+  calls := map[string]int{}
+  release := make(chan struct{})
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    mu.Lock()
+    calls[req.URL.Host]++
+    mu.Unlock()
+    if req.URL.Host == "viacep.com.br" {
+      <-release
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  const callers = 10
+  var started, done sync.WaitGroup
+  started.Add(callers)
+  done.Add(callers)
+  for i := 0; i < callers; i++ {
+    go func() {
+      defer done.Done()
+      started.Done()
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001-000", nil)
+      if err != nil {
+        t.Error(err)
+        return
+      }
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+      if status := rr.Code; status != http.StatusOK {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+    }()
+  }
+
+  started.Wait()
+  // Give the callers time to queue up behind the in-flight CEP lookup.
+  time.Sleep(20 * time.Millisecond)
+  close(release)
+  done.Wait()
+
+  mu.Lock()
+  defer mu.Unlock()
+  if calls["viacep.com.br"] != 1 || calls["api.weatherapi.com"] != 1 {
+    t.Errorf("Expected one call per upstream for concurrent identical requests, got %v", calls)
+  }
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// sourceIP is the source query value that locates the caller by IP address.
+const sourceIP = "ip"
+
+var errClientIPNotPublic = errors.New("client ip is not a public address")
+
+// clientIP returns the address of the client that sent r; see clientAddr.
+// Only public unicast addresses are accepted, since WeatherAPI can not
+// geolocate loopback, private or link-local ranges.
+func (s *Server) clientIP(r *http.Request) (netip.Addr, error) {
+	addr, err := s.clientAddr(r)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return netip.Addr{}, errClientIPNotPublic
+	}
+	return addr, nil
+}
+
+// clientAddr returns the address of the client that sent r. X-Forwarded-For
+// is only believed when the direct peer is a trusted proxy, since anyone
+// else can write whatever they like in it. The header is then walked from
+// the right, skipping the trusted proxies that appended to it, and the first
+// address they did not vouch for is the client.
+func (s *Server) clientAddr(r *http.Request) (netip.Addr, error) {
+	client, err := peerAddr(r)
+	if err != nil || !s.config.trustsProxy(client) {
+		return client, err
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		client = addr.Unmap().WithZone("")
+		if !s.config.trustsProxy(client) {
+			break
+		}
+	}
+	return client, nil
+}
+
+// peerAddr returns the address of the direct peer, from r.RemoteAddr.
+func peerAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap().WithZone(""), nil
+}
+
+// fetchTemperatureForIP looks up the weather where WeatherAPI places ip. The
+// address is sent as q directly: WeatherAPI's "auto:ip" shortcut would
+// resolve the address of this server, not the client's.
+func (s *Server) fetchTemperatureForIP(ctx context.Context, ip, lang string) (*TemperatureResponse, error) {
+	return s.lookupWeather(ctx, ip, lang, msgClientIPNotFound)
+}
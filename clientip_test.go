@@ -0,0 +1,162 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "net/netip"
+  "testing"
+)
+
+func TestTemperatureHandlerSourceIP(t *testing.T) {
+  var weatherQuery string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host != "api.weatherapi.com" {
+      t.Errorf("Expected only WeatherAPI to be called, got %s", req.URL.Host)
+    }
+    weatherQuery = req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, `{"location": {"name": "Mountain View"}, "current": {"temp_c": 18.0}}`), nil
+  }))
+
+  tests := []struct {
+    name          string
+    remoteAddr    string
+    expectedQuery string
+  }{
+    {"IPv4", "8.8.8.8:51234", "8.8.8.8"},
+    {"IPv6", "[2001:4860:4860::8888]:51234", "2001:4860:4860::8888"},
+    {"IPv4-mapped IPv6", "[::ffff:8.8.4.4]:51234", "8.8.4.4"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?source=ip", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      req.RemoteAddr = tt.remoteAddr
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      if weatherQuery != tt.expectedQuery {
+        t.Errorf("Expected WeatherAPI to be queried for %q, got %q", tt.expectedQuery, weatherQuery)
+      }
+
+      if cc := rr.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+        t.Errorf("Expected a private Cache-Control, got %q", cc)
+      }
+
+      var response TemperatureResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if response.TempC != 18.0 || response.City != "Mountain View" {
+        t.Errorf("Expected 18 C in Mountain View, got %v C in %q", response.TempC, response.City)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerSourceIPErrors(t *testing.T) {
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+  }))
+
+  tests := []struct {
+    name            string
+    query           string
+    remoteAddr      string
+    expectedStatus  int
+    expectedMessage string
+  }{
+    {"Unknown Source", "?source=gps", "8.8.8.8:51234", http.StatusUnprocessableEntity, "source inválido"},
+    {"Loopback", "?source=ip", "127.0.0.1:51234", http.StatusUnprocessableEntity, "IP do cliente inválido"},
+    {"Private", "?source=ip", "192.168.0.10:51234", http.StatusUnprocessableEntity, "IP do cliente inválido"},
+    {"Private IPv6", "?source=ip", "[fd00::1]:51234", http.StatusUnprocessableEntity, "IP do cliente inválido"},
+    {"Malformed", "?source=ip", "not-an-ip", http.StatusUnprocessableEntity, "IP do cliente inválido"},
+    {"Unresolvable", "?source=ip", "203.0.113.7:51234", http.StatusNotFound, "não foi possível encontrar a localização do IP"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      req.RemoteAddr = tt.remoteAddr
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expectedStatus {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+  cfg := testConfig()
+  cfg.TrustedProxies = []netip.Prefix{
+    netip.MustParsePrefix("10.0.0.0/8"),
+    netip.MustParsePrefix("fd00::/8"),
+  }
+  s := NewServer(cfg, nil)
+
+  tests := []struct {
+    name          string
+    remoteAddr    string
+    forwardedFor  []string
+    expected      string
+    expectedError bool
+  }{
+    {"Untrusted peer ignores header", "8.8.8.8:51234", []string{"1.1.1.1"}, "8.8.8.8", false},
+    {"Untrusted private peer", "192.168.0.10:51234", []string{"8.8.8.8"}, "", true},
+    {"Trusted peer", "10.0.0.5:51234", []string{"8.8.8.8"}, "8.8.8.8", false},
+    {"Trusted IPv6 peer", "[fd00::5]:51234", []string{"2001:4860:4860::8888"}, "2001:4860:4860::8888", false},
+    {"Spoofed leftmost entry", "10.0.0.5:51234", []string{"1.1.1.1, 8.8.8.8"}, "8.8.8.8", false},
+    {"Chain of trusted proxies", "10.0.0.5:51234", []string{"1.1.1.1, 8.8.8.8, 10.0.0.9"}, "8.8.8.8", false},
+    {"Repeated headers", "10.0.0.5:51234", []string{"1.1.1.1", "8.8.4.4"}, "8.8.4.4", false},
+    {"Trusted peer without header", "10.0.0.5:51234", nil, "", true},
+    {"Malformed entry", "10.0.0.5:51234", []string{"not-an-ip"}, "", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "/temperature?source=ip", nil)
+      req.RemoteAddr = tt.remoteAddr
+      for _, value := range tt.forwardedFor {
+        req.Header.Add("X-Forwarded-For", value)
+      }
+
+      addr, err := s.clientIP(req)
+      if tt.expectedError {
+        if err == nil {
+          t.Errorf("Expected an error, got %v", addr)
+        }
+        return
+      }
+      if err != nil {
+        t.Fatalf("Expected no error, got %v", err)
+      }
+      if addr.String() != tt.expected {
+        t.Errorf("Expected client IP %s, got %s", tt.expected, addr)
+      }
+    })
+  }
+}
@@ -0,0 +1,13 @@
+package main
+
+import "time"
+
+// Clock tells the caches and the circuit breaker what time it is, so tests
+// can move time forward instead of sleeping past a TTL or cooldown.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
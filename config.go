@@ -0,0 +1,518 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	defaultPort        = "8080"
+	defaultCacheMaxAge = 60 * time.Second
+	defaultUserAgent   = "cap-temp-go/1.0"
+)
+
+// Config holds the settings read from the environment at startup.
+type Config struct {
+	Port string
+	// ListenAddr, when set, is the host:port to bind and takes precedence
+	// over Port; see listenAddr.
+	ListenAddr string
+	// APIPrefix is prepended to every route, e.g. "/api/v1"; empty serves
+	// them at the root.
+	APIPrefix string
+	// WeatherAPIKeys are used one at a time, moving to the next when a key
+	// runs out of quota.
+	WeatherAPIKeys []string
+
+	WeatherAPIBaseURL string
+	ViaCEPBaseURL     string
+	IBGEBaseURL       string
+	// OpenWeatherMapAPIKey enables OpenWeatherMap as a fallback when
+	// WeatherAPI fails.
+	OpenWeatherMapAPIKey  string
+	OpenWeatherMapBaseURL string
+	// WeatherAPIParams names the /temperature query parameters forwarded to
+	// WeatherAPI as they are; see passthroughParams.
+	WeatherAPIParams []string
+	// UserAgent is sent on every outbound request.
+	UserAgent string
+
+	HTTPClientTimeout time.Duration
+	RequestTimeout    time.Duration
+	ShutdownTimeout   time.Duration
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout tune the
+	// outbound connection pool; see newHTTPClient.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	WeatherCacheTTL  time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	LocationCacheTTL time.Duration
+	// CacheSweepInterval is how often expired cache entries are evicted;
+	// see runCacheJanitor.
+	CacheSweepInterval time.Duration
+	// PreloadCEPsFile, when set, names a newline-delimited list of CEPs
+	// resolved into the location cache at startup.
+	PreloadCEPsFile string
+
+	MaxUpstreamRequests int
+
+	// MaxBodyBytes caps the size of POST request bodies.
+	MaxBodyBytes int64
+	// MaxUpstreamBodyBytes caps how much of an upstream response is read.
+	MaxUpstreamBodyBytes int64
+
+	CacheMaxAge time.Duration
+
+	TempDecimals  int
+	KelvinPrecise bool
+
+	// AllowedUFs, when set, limits CEP lookups to these states; see
+	// ufAllowed.
+	AllowedUFs []string
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-* headers are
+	// believed; see trustsProxy.
+	TrustedProxies []netip.Prefix
+
+	// LogLevel is the minimum level written to the logs.
+	LogLevel slog.Level
+	// ErrorLanguages are the languages error messages can be sent in, the
+	// first being the default; see errorLanguage.
+	ErrorLanguages []string
+
+	// AllowMock enables the canned ?mock=true response for smoke tests.
+	AllowMock bool
+	// DefaultUnits is nil unless TEMP_DEFAULT_UNITS picks a subset; see
+	// defaultUnits.
+	DefaultUnits []temperatureUnit
+}
+
+// defaultConfig returns the settings used when no environment variable
+// overrides them.
+func defaultConfig() Config {
+	return Config{
+		Port:                  defaultPort,
+		WeatherAPIBaseURL:     defaultWeatherAPIBaseURL,
+		ViaCEPBaseURL:         defaultViaCEPBaseURL,
+		IBGEBaseURL:           defaultIBGEBaseURL,
+		OpenWeatherMapBaseURL: defaultOpenWeatherMapBaseURL,
+		UserAgent:             defaultUserAgent,
+		HTTPClientTimeout:     defaultHTTPClientTimeout,
+		RequestTimeout:        defaultRequestTimeout,
+		ShutdownTimeout:       defaultShutdownTimeout,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		WeatherCacheTTL:       defaultWeatherCacheTTL,
+		BreakerThreshold:      defaultBreakerThreshold,
+		BreakerCooldown:       defaultBreakerCooldown,
+		LocationCacheTTL:      defaultLocationCacheTTL,
+		CacheSweepInterval:    defaultCacheSweepInterval,
+		MaxUpstreamRequests:   defaultMaxUpstreamRequests,
+		MaxBodyBytes:          defaultMaxBodyBytes,
+		MaxUpstreamBodyBytes:  defaultMaxUpstreamBodyBytes,
+		CacheMaxAge:           defaultCacheMaxAge,
+		TempDecimals:          defaultTempDecimals,
+		KelvinPrecise:         true,
+		LogLevel:              slog.LevelInfo,
+		ErrorLanguages:        defaultErrorLanguages,
+	}
+}
+
+// LoadConfig reads the configuration from the environment. Invalid optional
+// values are logged and replaced by their defaults; the returned error
+// reports settings the service cannot run without.
+func LoadConfig() (Config, error) {
+	defaults := defaultConfig()
+
+	cfg := Config{
+		Port:                  os.Getenv("PORT"),
+		ListenAddr:            os.Getenv("LISTEN_ADDR"),
+		APIPrefix:             pathPrefixFromEnv("API_PREFIX"),
+		WeatherAPIKeys:        weatherAPIKeysFromEnv(),
+		WeatherAPIBaseURL:     baseURLFromEnv("WEATHER_API_BASE_URL", defaults.WeatherAPIBaseURL),
+		ViaCEPBaseURL:         baseURLFromEnv("VIACEP_BASE_URL", defaults.ViaCEPBaseURL),
+		IBGEBaseURL:           baseURLFromEnv("IBGE_BASE_URL", defaults.IBGEBaseURL),
+		OpenWeatherMapAPIKey:  os.Getenv("OPENWEATHERMAP_API_KEY"),
+		OpenWeatherMapBaseURL: baseURLFromEnv("OPENWEATHERMAP_BASE_URL", defaults.OpenWeatherMapBaseURL),
+		UserAgent:             stringFromEnv("HTTP_USER_AGENT", defaults.UserAgent),
+		WeatherAPIParams:      paramNamesFromEnv("WEATHER_API_PASSTHROUGH_PARAMS"),
+		HTTPClientTimeout:     durationFromEnv("HTTP_CLIENT_TIMEOUT", defaults.HTTPClientTimeout),
+		RequestTimeout:        durationFromEnv("REQUEST_TIMEOUT", defaults.RequestTimeout),
+		ShutdownTimeout:       durationFromEnv("SHUTDOWN_TIMEOUT", defaults.ShutdownTimeout),
+		MaxIdleConns:          intFromEnv("HTTP_MAX_IDLE_CONNS", defaults.MaxIdleConns),
+		MaxIdleConnsPerHost:   intFromEnv("HTTP_MAX_IDLE_CONNS_PER_HOST", defaults.MaxIdleConnsPerHost),
+		IdleConnTimeout:       durationFromEnv("HTTP_IDLE_CONN_TIMEOUT", defaults.IdleConnTimeout),
+		WeatherCacheTTL:       ttlFromEnv("WEATHER_CACHE_TTL", defaults.WeatherCacheTTL),
+		BreakerThreshold:      intFromEnv("WEATHER_BREAKER_THRESHOLD", defaults.BreakerThreshold),
+		BreakerCooldown:       durationFromEnv("WEATHER_BREAKER_COOLDOWN", defaults.BreakerCooldown),
+		LocationCacheTTL:      ttlFromEnv("LOCATION_CACHE_TTL", defaults.LocationCacheTTL),
+		CacheSweepInterval:    ttlFromEnv("CACHE_SWEEP_INTERVAL", defaults.CacheSweepInterval),
+		PreloadCEPsFile:       os.Getenv("PRELOAD_CEPS_FILE"),
+		MaxUpstreamRequests:   intFromEnv("UPSTREAM_MAX_CONCURRENCY", defaults.MaxUpstreamRequests),
+		MaxBodyBytes:          int64FromEnv("MAX_REQUEST_BODY_BYTES", defaults.MaxBodyBytes),
+		MaxUpstreamBodyBytes:  int64FromEnv("UPSTREAM_MAX_BODY_BYTES", defaults.MaxUpstreamBodyBytes),
+		CacheMaxAge:           ttlFromEnv("CACHE_MAX_AGE", defaults.CacheMaxAge),
+		TempDecimals:          intFromEnv("TEMP_DECIMALS", defaults.TempDecimals),
+		KelvinPrecise:         boolFromEnv("KELVIN_PRECISE", defaults.KelvinPrecise),
+		DefaultUnits:          unitsFromEnv("TEMP_DEFAULT_UNITS", defaults.DefaultUnits),
+		AllowMock:             boolFromEnv("ALLOW_MOCK", defaults.AllowMock),
+		AllowedUFs:            ufsFromEnv("ALLOWED_UFS"),
+		TrustedProxies:        prefixesFromEnv("TRUSTED_PROXIES"),
+		LogLevel:              logLevelFromEnv("LOG_LEVEL", defaults.LogLevel),
+		ErrorLanguages:        languagesFromEnv("ERROR_LANGUAGES", defaults.ErrorLanguages),
+	}
+	if cfg.Port == "" {
+		cfg.Port = defaults.Port
+	}
+
+	return cfg, cfg.validate()
+}
+
+// checkConfig loads the configuration the way main does, reports the
+// outcome and returns the process exit code: 0 when the service could start,
+// 1 otherwise. It backs the -check flag and CHECK_CONFIG.
+func checkConfig(stdout, stderr io.Writer) int {
+	if _, err := LoadConfig(); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "configuration OK")
+	return 0
+}
+
+// validate reports settings the service cannot run without. An invalid
+// LISTEN_ADDR is fatal rather than ignored: falling back to PORT would bind
+// every interface when the operator asked for fewer.
+func (c Config) validate() error {
+	if len(c.WeatherAPIKeys) == 0 {
+		return errors.New("WEATHER_API_KEY or WEATHER_API_KEYS environment variable not set")
+	}
+	if c.ListenAddr != "" {
+		if err := validateListenAddr(c.ListenAddr); err != nil {
+			return fmt.Errorf("invalid LISTEN_ADDR %q: %w", c.ListenAddr, err)
+		}
+	}
+	return nil
+}
+
+// listenAddr returns the address the server binds: ListenAddr when set,
+// otherwise Port on all interfaces.
+func (c Config) listenAddr() string {
+	if c.ListenAddr != "" {
+		return c.ListenAddr
+	}
+	return ":" + c.Port
+}
+
+// ufAllowed reports whether CEPs in uf may be served. Every state is allowed
+// when AllowedUFs is empty.
+func (c Config) ufAllowed(uf string) bool {
+	if len(c.AllowedUFs) == 0 {
+		return true
+	}
+	uf = strings.ToUpper(strings.TrimSpace(uf))
+	for _, allowed := range c.AllowedUFs {
+		if uf == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsProxy reports whether addr is one of TrustedProxies. With none
+// configured no peer is trusted, so X-Forwarded-* headers are ignored.
+func (c Config) trustsProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateListenAddr checks that addr is a host:port pair with a numeric
+// port. The host may be empty to listen on all interfaces.
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("port %q must be a number between 0 and 65535", port)
+	}
+
+	return nil
+}
+
+// weatherAPIKeysFromEnv reads the comma-separated WEATHER_API_KEYS, falling
+// back to the single WEATHER_API_KEY.
+func weatherAPIKeysFromEnv() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("WEATHER_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		return keys
+	}
+
+	if key := os.Getenv("WEATHER_API_KEY"); key != "" {
+		return []string{key}
+	}
+	return nil
+}
+
+// ufsFromEnv reads the named env var as a comma-separated list of state
+// abbreviations such as "SP,RJ", upper-cased. Entries that aren't two
+// letters are logged and skipped.
+func ufsFromEnv(name string) []string {
+	var ufs []string
+	for _, uf := range strings.Split(os.Getenv(name), ",") {
+		uf = strings.ToUpper(strings.TrimSpace(uf))
+		if uf == "" {
+			continue
+		}
+		if len(uf) != 2 || strings.Trim(uf, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			logger.Warn("invalid UF, skipping", "variable", name, "value", uf)
+			continue
+		}
+		ufs = append(ufs, uf)
+	}
+	return ufs
+}
+
+// paramNamesFromEnv reads the named env var as a comma-separated list of
+// query parameter names, lower-cased. The reserved WeatherAPI parameters are
+// logged and skipped.
+func paramNamesFromEnv(name string) []string {
+	var names []string
+	for _, param := range strings.Split(os.Getenv(name), ",") {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param == "" {
+			continue
+		}
+		if reservedWeatherParams[param] {
+			logger.Warn("reserved WeatherAPI parameter, skipping", "variable", name, "value", param)
+			continue
+		}
+		names = append(names, param)
+	}
+	return names
+}
+
+// languagesFromEnv reads the named env var as a comma-separated list of
+// language tags such as "pt-BR,en", the first being the default. Tags
+// without a message bundle are logged and skipped; fallback is returned
+// when none is left.
+func languagesFromEnv(name string, fallback []string) []string {
+	var langs []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		tag, err := language.Parse(value)
+		if _, ok := errorMessageBundles[tag.String()]; err != nil || !ok {
+			logger.Warn("unsupported language, skipping", "variable", name, "value", value)
+			continue
+		}
+		langs = append(langs, tag.String())
+	}
+	if len(langs) == 0 {
+		return fallback
+	}
+	return langs
+}
+
+// prefixesFromEnv reads the named env var as a comma-separated list of CIDRs
+// such as "10.0.0.0/8,192.168.1.7". A bare address stands for itself alone.
+// Entries that don't parse are logged and skipped.
+func prefixesFromEnv(name string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				logger.Warn("invalid CIDR, skipping", "variable", name, "value", value)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// pathPrefixFromEnv returns the named env var as a path prefix with a leading
+// slash and no trailing one, so "api/v1/" becomes "/api/v1". "/" and an
+// unset variable both mean no prefix.
+func pathPrefixFromEnv(name string) string {
+	value := strings.Trim(os.Getenv(name), "/")
+	if value == "" {
+		return ""
+	}
+	return "/" + value
+}
+
+// stringFromEnv returns the named env var, or fallback when it is unset or
+// blank.
+func stringFromEnv(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// baseURLFromEnv returns the named env var without a trailing slash, so
+// paths can be appended to it directly.
+func baseURLFromEnv(name, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(value, "/")
+}
+
+// intFromEnv parses the named env var as a non-negative integer, returning
+// fallback when it is unset or invalid.
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Warn("invalid integer, using default", "variable", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// int64FromEnv parses the named env var as a positive integer, returning
+// fallback when it is unset or invalid.
+func int64FromEnv(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		logger.Warn("invalid integer, using default", "variable", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// durationFromEnv parses the named env var as a positive Go duration,
+// returning fallback when it is unset or invalid.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		logger.Warn("invalid duration, using default", "variable", name, "value", value, "default", fallback.String())
+		return fallback
+	}
+
+	return duration
+}
+
+// ttlFromEnv is like durationFromEnv but also accepts zero, which disables
+// the cache the TTL belongs to.
+func ttlFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		logger.Warn("invalid duration, using default", "variable", name, "value", value, "default", fallback.String())
+		return fallback
+	}
+
+	return duration
+}
+
+// boolFromEnv parses the named env var with strconv.ParseBool, returning
+// fallback when it is unset or invalid.
+func boolFromEnv(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warn("invalid boolean, using default", "variable", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return b
+}
+
+// logLevelFromEnv parses the named env var as debug, info, warn or error,
+// returning fallback when it is unset or invalid.
+func logLevelFromEnv(name string, fallback slog.Level) slog.Level {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		logger.Warn("invalid log level, using default", "variable", name, "value", value, "default", fallback.String())
+		return fallback
+	}
+
+	return level
+}
+
+// unitsFromEnv parses the named env var as a unit list such as "k,c,f",
+// returning fallback when it is unset or invalid.
+func unitsFromEnv(name string, fallback []temperatureUnit) []temperatureUnit {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	units, err := parseUnitList(value)
+	if err != nil {
+		logger.Warn("invalid units, using default", "variable", name, "value", value, "error", err.Error())
+		return fallback
+	}
+
+	return units
+}
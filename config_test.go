@@ -0,0 +1,417 @@
+package main
+
+import (
+  "encoding/json"
+  "log/slog"
+  "net/http"
+  "net/http/httptest"
+  "net/netip"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+// configEnvVars lists every variable read by LoadConfig, so tests start from
+// a clean environment.
+var configEnvVars = []string{
+  "PORT",
+  "LISTEN_ADDR",
+  "API_PREFIX",
+  "WEATHER_API_KEY",
+  "WEATHER_API_KEYS",
+  "WEATHER_API_BASE_URL",
+  "VIACEP_BASE_URL",
+  "IBGE_BASE_URL",
+  "OPENWEATHERMAP_API_KEY",
+  "OPENWEATHERMAP_BASE_URL",
+  "HTTP_USER_AGENT",
+  "WEATHER_API_PASSTHROUGH_PARAMS",
+  "HTTP_CLIENT_TIMEOUT",
+  "REQUEST_TIMEOUT",
+  "SHUTDOWN_TIMEOUT",
+  "HTTP_MAX_IDLE_CONNS",
+  "HTTP_MAX_IDLE_CONNS_PER_HOST",
+  "HTTP_IDLE_CONN_TIMEOUT",
+  "WEATHER_CACHE_TTL",
+  "WEATHER_BREAKER_THRESHOLD",
+  "WEATHER_BREAKER_COOLDOWN",
+  "LOCATION_CACHE_TTL",
+  "CACHE_SWEEP_INTERVAL",
+  "PRELOAD_CEPS_FILE",
+  "UPSTREAM_MAX_CONCURRENCY",
+  "MAX_REQUEST_BODY_BYTES",
+  "UPSTREAM_MAX_BODY_BYTES",
+  "CACHE_MAX_AGE",
+  "TEMP_DECIMALS",
+  "KELVIN_PRECISE",
+  "TEMP_DEFAULT_UNITS",
+  "ALLOW_MOCK",
+  "ALLOWED_UFS",
+  "TRUSTED_PROXIES",
+  "LOG_LEVEL",
+  "ERROR_LANGUAGES",
+}
+
+func clearConfigEnv(t *testing.T) {
+  for _, name := range configEnvVars {
+    t.Setenv(name, "")
+  }
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+  clearConfigEnv(t)
+  t.Setenv("WEATHER_API_KEY", "env-key")
+
+  cfg, err := LoadConfig()
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  expected := defaultConfig()
+  expected.WeatherAPIKeys = []string{"env-key"}
+  if !reflect.DeepEqual(cfg, expected) {
+    t.Errorf("LoadConfig() = %+v; want %+v", cfg, expected)
+  }
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+  clearConfigEnv(t)
+  t.Setenv("PORT", "9090")
+  t.Setenv("LISTEN_ADDR", "127.0.0.1:9091")
+  t.Setenv("API_PREFIX", "api/v1/")
+  t.Setenv("WEATHER_API_KEY", "env-key")
+  t.Setenv("WEATHER_API_KEYS", " key-a, key-b ,,")
+  t.Setenv("WEATHER_API_BASE_URL", "http://weather.staging.local/v1/")
+  t.Setenv("VIACEP_BASE_URL", "http://viacep.staging.local/ws")
+  t.Setenv("IBGE_BASE_URL", "http://ibge.staging.local/localidades/")
+  t.Setenv("OPENWEATHERMAP_API_KEY", "owm-key")
+  t.Setenv("OPENWEATHERMAP_BASE_URL", "http://owm.staging.local/data/2.5/")
+  t.Setenv("HTTP_USER_AGENT", "cap-temp-go-staging/2.0")
+  t.Setenv("WEATHER_API_PASSTHROUGH_PARAMS", " Alerts,key,,tp,AQI,lang ")
+  t.Setenv("HTTP_CLIENT_TIMEOUT", "3s")
+  t.Setenv("REQUEST_TIMEOUT", "5s")
+  t.Setenv("SHUTDOWN_TIMEOUT", "30s")
+  t.Setenv("HTTP_MAX_IDLE_CONNS", "200")
+  t.Setenv("HTTP_MAX_IDLE_CONNS_PER_HOST", "50")
+  t.Setenv("HTTP_IDLE_CONN_TIMEOUT", "2m")
+  t.Setenv("WEATHER_CACHE_TTL", "0")
+  t.Setenv("WEATHER_BREAKER_THRESHOLD", "0")
+  t.Setenv("WEATHER_BREAKER_COOLDOWN", "1m")
+  t.Setenv("LOCATION_CACHE_TTL", "1h")
+  t.Setenv("CACHE_SWEEP_INTERVAL", "30s")
+  t.Setenv("PRELOAD_CEPS_FILE", "/etc/cap-temp/ceps.txt")
+  t.Setenv("UPSTREAM_MAX_CONCURRENCY", "10")
+  t.Setenv("MAX_REQUEST_BODY_BYTES", "4096")
+  t.Setenv("UPSTREAM_MAX_BODY_BYTES", "65536")
+  t.Setenv("CACHE_MAX_AGE", "5m")
+  t.Setenv("TEMP_DECIMALS", "1")
+  t.Setenv("KELVIN_PRECISE", "false")
+  t.Setenv("TEMP_DEFAULT_UNITS", "k,c")
+  t.Setenv("ALLOW_MOCK", "true")
+  t.Setenv("ALLOWED_UFS", " sp, RJ ,São,,mg")
+  t.Setenv("TRUSTED_PROXIES", "10.1.2.3/8, 192.168.0.7,proxy,,fd00::/8")
+  t.Setenv("LOG_LEVEL", "warn")
+  t.Setenv("ERROR_LANGUAGES", "en, pt-br,fr,,")
+
+  cfg, err := LoadConfig()
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  expected := Config{
+    Port:                  "9090",
+    ListenAddr:            "127.0.0.1:9091",
+    APIPrefix:             "/api/v1",
+    WeatherAPIKeys:        []string{"key-a", "key-b"},
+    WeatherAPIBaseURL:     "http://weather.staging.local/v1",
+    ViaCEPBaseURL:         "http://viacep.staging.local/ws",
+    IBGEBaseURL:           "http://ibge.staging.local/localidades",
+    OpenWeatherMapAPIKey:  "owm-key",
+    OpenWeatherMapBaseURL: "http://owm.staging.local/data/2.5",
+    UserAgent:             "cap-temp-go-staging/2.0",
+    WeatherAPIParams:      []string{"alerts", "tp"},
+    HTTPClientTimeout:     3 * time.Second,
+    RequestTimeout:        5 * time.Second,
+    ShutdownTimeout:       30 * time.Second,
+    MaxIdleConns:          200,
+    MaxIdleConnsPerHost:   50,
+    IdleConnTimeout:       2 * time.Minute,
+    WeatherCacheTTL:       0,
+    BreakerThreshold:      0,
+    BreakerCooldown:       time.Minute,
+    LocationCacheTTL:      time.Hour,
+    CacheSweepInterval:    30 * time.Second,
+    PreloadCEPsFile:       "/etc/cap-temp/ceps.txt",
+    MaxUpstreamRequests:   10,
+    MaxBodyBytes:          4096,
+    MaxUpstreamBodyBytes:  65536,
+    CacheMaxAge:           5 * time.Minute,
+    TempDecimals:          1,
+    KelvinPrecise:         false,
+    AllowMock:             true,
+    AllowedUFs:            []string{"SP", "RJ", "MG"},
+    TrustedProxies: []netip.Prefix{
+      netip.MustParsePrefix("10.0.0.0/8"),
+      netip.MustParsePrefix("192.168.0.7/32"),
+      netip.MustParsePrefix("fd00::/8"),
+    },
+    LogLevel:       slog.LevelWarn,
+    ErrorLanguages: []string{"en", "pt-BR"},
+  }
+  if codes := unitCodes(cfg.DefaultUnits); codes != "k,c" {
+    t.Errorf("Expected default units k,c, got %s", codes)
+  }
+  cfg.DefaultUnits = nil
+  if !reflect.DeepEqual(cfg, expected) {
+    t.Errorf("LoadConfig() = %+v; want %+v", cfg, expected)
+  }
+}
+
+func TestLoadConfigInvalidValues(t *testing.T) {
+  clearConfigEnv(t)
+  t.Setenv("WEATHER_API_KEY", "env-key")
+  t.Setenv("HTTP_CLIENT_TIMEOUT", "soon")
+  t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+  t.Setenv("WEATHER_CACHE_TTL", "-1s")
+  t.Setenv("WEATHER_BREAKER_THRESHOLD", "many")
+  t.Setenv("TEMP_DECIMALS", "-1")
+  t.Setenv("KELVIN_PRECISE", "maybe")
+  t.Setenv("TEMP_DEFAULT_UNITS", "k,x")
+  t.Setenv("LOG_LEVEL", "verbose")
+  t.Setenv("ERROR_LANGUAGES", "fr,klingon")
+
+  cfg, err := LoadConfig()
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  expected := defaultConfig()
+  expected.WeatherAPIKeys = []string{"env-key"}
+  if !reflect.DeepEqual(cfg, expected) {
+    t.Errorf("LoadConfig() = %+v; want %+v", cfg, expected)
+  }
+}
+
+func TestLoadConfigMissingAPIKey(t *testing.T) {
+  clearConfigEnv(t)
+
+  if _, err := LoadConfig(); err == nil {
+    t.Error("Expected error for missing WEATHER_API_KEY, got nil")
+  }
+}
+
+func TestCheckConfig(t *testing.T) {
+  clearConfigEnv(t)
+
+  var stdout, stderr strings.Builder
+  if code := checkConfig(&stdout, &stderr); code != 1 {
+    t.Errorf("Expected exit code 1 without WEATHER_API_KEY, got %d", code)
+  }
+  if !strings.Contains(stderr.String(), "WEATHER_API_KEY") {
+    t.Errorf("Expected the missing key to be reported, got %q", stderr.String())
+  }
+
+  t.Setenv("WEATHER_API_KEY", "env-key")
+  stdout.Reset()
+  stderr.Reset()
+  if code := checkConfig(&stdout, &stderr); code != 0 {
+    t.Errorf("Expected exit code 0 with a valid configuration, got %d: %s", code, stderr.String())
+  }
+  if stdout.String() != "configuration OK\n" {
+    t.Errorf("Expected a success message, got %q", stdout.String())
+  }
+}
+
+func unitCodes(units []temperatureUnit) string {
+  codes := make([]string, 0, len(units))
+  for _, unit := range units {
+    codes = append(codes, unit.Code)
+  }
+  return strings.Join(codes, ",")
+}
+
+func TestConfigValidate(t *testing.T) {
+  if err := (Config{WeatherAPIKeys: []string{"key"}}).validate(); err != nil {
+    t.Errorf("Expected no error, got %v", err)
+  }
+
+  if err := (Config{}).validate(); err == nil {
+    t.Error("Expected error for missing WEATHER_API_KEY, got nil")
+  }
+
+  if err := (Config{WeatherAPIKeys: []string{"key"}, ListenAddr: "localhost"}).validate(); err == nil {
+    t.Error("Expected error for LISTEN_ADDR without a port, got nil")
+  }
+}
+
+func TestLoadConfigInvalidListenAddr(t *testing.T) {
+  clearConfigEnv(t)
+  t.Setenv("WEATHER_API_KEY", "env-key")
+  t.Setenv("LISTEN_ADDR", "127.0.0.1")
+
+  if _, err := LoadConfig(); err == nil {
+    t.Error("Expected error for invalid LISTEN_ADDR, got nil")
+  }
+}
+
+func TestConfigListenAddr(t *testing.T) {
+  tests := []struct {
+    name       string
+    port       string
+    listenAddr string
+    expected   string
+  }{
+    {"Port Only", "8080", "", ":8080"},
+    {"Listen Addr Wins", "8080", "127.0.0.1:9090", "127.0.0.1:9090"},
+    {"IPv6 Listen Addr", "8080", "[::1]:9090", "[::1]:9090"},
+    {"Listen Addr All Interfaces", "8080", ":9090", ":9090"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := Config{Port: tt.port, ListenAddr: tt.listenAddr}
+      if addr := cfg.listenAddr(); addr != tt.expected {
+        t.Errorf("listenAddr() = %q; want %q", addr, tt.expected)
+      }
+    })
+  }
+}
+
+func TestValidateListenAddr(t *testing.T) {
+  tests := []struct {
+    addr  string
+    valid bool
+  }{
+    {"127.0.0.1:8080", true},
+    {"localhost:8080", true},
+    {"[::1]:8080", true},
+    {":8080", true},
+    {"127.0.0.1", false},
+    {"127.0.0.1:http", false},
+    {"127.0.0.1:70000", false},
+    {"::1:8080", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.addr, func(t *testing.T) {
+      if err := validateListenAddr(tt.addr); (err == nil) != tt.valid {
+        t.Errorf("validateListenAddr(%q) = %v; want valid=%v", tt.addr, err, tt.valid)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerMissingAPIKey(t *testing.T) {
+  weatherCalled := false
+  s := NewServer(defaultConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "api.weatherapi.com" {
+      weatherCalled = true
+    }
+    return mockResponse(http.StatusOK, mockViaCEPBody), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  req.Header.Set("Accept-Language", "en")
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusServiceUnavailable {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "service misconfigured"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+
+  if weatherCalled {
+    t.Error("Expected WeatherAPI not to be called without an API key")
+  }
+}
+
+func TestTemperatureHandlerAllowedUFs(t *testing.T) {
+  tests := []struct {
+    name       string
+    allowedUFs []string
+    expected   int
+  }{
+    {"No restriction", nil, http.StatusOK},
+    {"Allowed UF", []string{"RJ", "SP"}, http.StatusOK},
+    {"Disallowed UF", []string{"RJ", "MG"}, http.StatusForbidden},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := testConfig()
+      cfg.AllowedUFs = tt.allowedUFs
+      s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expected {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expected)
+      }
+      if tt.expected != http.StatusForbidden {
+        return
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.Message != "estado do CEP não permitido" {
+        t.Errorf("Expected message %q, got %q", "estado do CEP não permitido", response.Message)
+      }
+    })
+  }
+}
+
+func TestNewHTTPClientAppliesConfig(t *testing.T) {
+  cfg := defaultConfig()
+  cfg.HTTPClientTimeout = 3 * time.Second
+  cfg.MaxIdleConns = 200
+  cfg.MaxIdleConnsPerHost = 50
+  cfg.IdleConnTimeout = 2 * time.Minute
+
+  client := newHTTPClient(cfg)
+
+  if client.Timeout != 3*time.Second {
+    t.Errorf("Expected timeout 3s, got %v", client.Timeout)
+  }
+
+  transport, ok := client.Transport.(*http.Transport)
+  if !ok {
+    t.Fatalf("Expected an *http.Transport, got %T", client.Transport)
+  }
+  if transport.MaxIdleConns != 200 {
+    t.Errorf("Expected MaxIdleConns 200, got %d", transport.MaxIdleConns)
+  }
+  if transport.MaxIdleConnsPerHost != 50 {
+    t.Errorf("Expected MaxIdleConnsPerHost 50, got %d", transport.MaxIdleConnsPerHost)
+  }
+  if transport.IdleConnTimeout != 2*time.Minute {
+    t.Errorf("Expected IdleConnTimeout 2m, got %v", transport.IdleConnTimeout)
+  }
+  if !transport.ForceAttemptHTTP2 {
+    t.Error("Expected HTTP/2 to be attempted")
+  }
+  if transport == http.DefaultTransport {
+    t.Error("Expected a dedicated transport, not http.DefaultTransport")
+  }
+}
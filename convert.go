@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// absoluteZeroCelsius is the lowest temperature /convert accepts.
+	absoluteZeroCelsius = -273.15
+	// planckTemperatureKelvin is the highest: the Planck temperature, far
+	// enough below math.MaxFloat64 that converting it to any scale stays
+	// finite.
+	planckTemperatureKelvin = 1.416784e32
+)
+
+var (
+	errTemperatureNotFinite         = errors.New(msgInvalidValue)
+	errTemperatureBelowAbsoluteZero = errors.New(msgBelowAbsoluteZero)
+	errTemperatureTooHigh           = errors.New(msgAbovePlanck)
+)
+
+// validateTemperature checks that value, on the scale with the given unit
+// code, is a temperature that can exist: finite, no colder than absolute
+// zero and no hotter than the Planck temperature. The bounds are checked in
+// exact Kelvin whatever KELVIN_PRECISE says, since the legacy 273 offset
+// would let -0.1 K through as -273.1 °C.
+func validateTemperature(value float64, scale string) error {
+	unit, ok := findTemperatureUnit(strings.ToLower(scale))
+	if !ok {
+		return fmt.Errorf("unknown temperature scale %q", scale)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errTemperatureNotFinite
+	}
+
+	kelvin := exactKelvin(value, unit)
+	if kelvin < -1e-9 {
+		return errTemperatureBelowAbsoluteZero
+	}
+	if kelvin > planckTemperatureKelvin {
+		return errTemperatureTooHigh
+	}
+	return nil
+}
+
+// exactKelvin converts value on unit's scale to Kelvin with the exact
+// 273.15 offset, unrounded.
+func exactKelvin(value float64, unit temperatureUnit) float64 {
+	switch unit.Code {
+	case "k":
+		return value
+	case "r":
+		return value * 5 / 9
+	case "f":
+		return fahrenheitToCelsius(value) - absoluteZeroCelsius
+	}
+	return value - absoluteZeroCelsius
+}
+
+type ConvertResponse struct {
+	Value float64 `json:"value"`
+	From  string  `json:"from"`
+	To    string  `json:"to"`
+}
+
+// convertTemperature converts value between two scales through Celsius.
+// Converting a scale to itself returns value unchanged.
+func convertTemperature(value float64, from, to temperatureUnit) float64 {
+	if from.Code == to.Code {
+		return value
+	}
+	return to.FromCelsius(from.ToCelsius(value))
+}
+
+// convertHandler serves /convert?value=25&from=c&to=f, converting an
+// arbitrary temperature between the supported scales.
+func (s *Server) convertHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	value, err := strconv.ParseFloat(query.Get("value"), 64)
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidValue)
+		return
+	}
+
+	from, ok := s.temperatureUnit(strings.ToLower(query.Get("from")))
+	if !ok {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidFrom)
+		return
+	}
+
+	to, ok := s.temperatureUnit(strings.ToLower(query.Get("to")))
+	if !ok {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidTo)
+		return
+	}
+
+	if err := validateTemperature(value, from.Code); err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ConvertResponse{
+		Value: roundTo(convertTemperature(value, from, to), s.config.TempDecimals),
+		From:  from.Code,
+		To:    to.Code,
+	})
+}
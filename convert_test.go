@@ -0,0 +1,137 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "math"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestConvertHandler(t *testing.T) {
+  // The same temperature on every scale: 25°C
+  values := map[string]float64{
+    "c": 25,
+    "f": 77,
+    "k": 298.15,
+    "r": 536.67,
+  }
+
+  for _, from := range temperatureUnits {
+    for _, to := range temperatureUnits {
+      t.Run(from.Code+"_to_"+to.Code, func(t *testing.T) {
+        query := fmt.Sprintf("/convert?value=%v&from=%s&to=%s", values[from.Code], from.Code, to.Code)
+        req, err := http.NewRequest("GET", query, nil)
+        if err != nil {
+          t.Fatal(err)
+        }
+
+        rr := httptest.NewRecorder()
+        http.HandlerFunc(NewServer(defaultConfig(), nil).convertHandler).ServeHTTP(rr, req)
+
+        if status := rr.Code; status != http.StatusOK {
+          t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+        }
+
+        var response ConvertResponse
+        if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+          t.Fatalf("Failed to parse response body: %v", err)
+        }
+
+        expected := ConvertResponse{Value: values[to.Code], From: from.Code, To: to.Code}
+        if response != expected {
+          t.Errorf("handler returned unexpected body: got %+v want %+v", response, expected)
+        }
+      })
+    }
+  }
+}
+
+func TestConvertHandlerInvalidInput(t *testing.T) {
+  tests := []struct {
+    name            string
+    query           string
+    expectedMessage string
+  }{
+    {"Missing Value", "from=c&to=f", "valor inválido"},
+    {"Non Numeric Value", "value=warm&from=c&to=f", "valor inválido"},
+    {"NaN Value", "value=NaN&from=c&to=f", "valor inválido"},
+    {"Unknown From", "value=25&from=x&to=f", "from inválido"},
+    {"Missing To", "value=25&from=c", "to inválido"},
+    {"Below Absolute Zero", "value=-1&from=k&to=c", "valor abaixo do zero absoluto"},
+    {"Infinite Value", "value=Inf&from=c&to=f", "valor inválido"},
+    {"Overflowing Value", "value=1e308&from=c&to=f", "valor acima da temperatura de Planck"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/convert?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(NewServer(defaultConfig(), nil).convertHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusUnprocessableEntity {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
+
+func TestConvertTemperatureIdentity(t *testing.T) {
+  for _, unit := range temperatureUnits {
+    if got := convertTemperature(12.3456789, unit, unit); got != 12.3456789 {
+      t.Errorf("convertTemperature(12.3456789, %s, %s) = %v; want unchanged", unit.Code, unit.Code, got)
+    }
+  }
+}
+
+func TestValidateTemperature(t *testing.T) {
+  tests := []struct {
+    name     string
+    value    float64
+    scale    string
+    expected error
+  }{
+    {"Room Temperature", 25, "c", nil},
+    {"Absolute Zero Celsius", -273.15, "c", nil},
+    {"Absolute Zero Kelvin", 0, "K", nil},
+    {"Absolute Zero Fahrenheit", -459.67, "f", nil},
+    {"Below Absolute Zero Celsius", -273.16, "c", errTemperatureBelowAbsoluteZero},
+    {"Below Absolute Zero Kelvin", -0.01, "k", errTemperatureBelowAbsoluteZero},
+    {"Below Absolute Zero Fahrenheit", -460, "f", errTemperatureBelowAbsoluteZero},
+    {"Below Absolute Zero Rankine", -1, "r", errTemperatureBelowAbsoluteZero},
+    {"Near Absolute Zero Celsius", -273.1, "c", nil},
+    {"NaN", math.NaN(), "c", errTemperatureNotFinite},
+    {"Positive Infinity", math.Inf(1), "k", errTemperatureNotFinite},
+    {"Negative Infinity", math.Inf(-1), "f", errTemperatureNotFinite},
+    {"Above Planck Temperature", 1e308, "c", errTemperatureTooHigh},
+    {"Above Planck Temperature Kelvin", 1.5e32, "k", errTemperatureTooHigh},
+    {"Largest Float Fahrenheit", math.MaxFloat64, "f", errTemperatureTooHigh},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if err := validateTemperature(tt.value, tt.scale); !errors.Is(err, tt.expected) {
+        t.Errorf("validateTemperature(%v, %q) = %v; want %v", tt.value, tt.scale, err, tt.expected)
+      }
+    })
+  }
+
+  if err := validateTemperature(25, "x"); err == nil {
+    t.Error("Expected an error for an unknown scale")
+  }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidLatitude  = errors.New(msgInvalidLatitude)
+	errInvalidLongitude = errors.New(msgInvalidLongitude)
+)
+
+// parseCoordinate parses a latitude or longitude, rejecting values outside
+// [-limit, limit].
+func parseCoordinate(value string, limit float64) (float64, bool) {
+	coord, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(coord) || coord < -limit || coord > limit {
+		return 0, false
+	}
+	return coord, true
+}
+
+// coordsQuery formats a coordinate pair as WeatherAPI's "lat,lon" q value.
+func coordsQuery(lat, lon float64) string {
+	return strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64)
+}
+
+// fetchTemperatureForCoords looks up the weather at a coordinate pair,
+// reported under the name of the place WeatherAPI resolves it to.
+func (s *Server) fetchTemperatureForCoords(ctx context.Context, lat, lon float64, lang string) (*TemperatureResponse, error) {
+	return s.lookupWeather(ctx, coordsQuery(lat, lon), lang, msgCoordsNotFound)
+}
+
+// coordsTemperatureHandler serves /temperature/coords?lat=-23.55&lon=-46.63,
+// skipping CEP resolution for clients that already know where they are.
+func (s *Server) coordsTemperatureHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(extractTraceContext(r), "coordsTemperatureHandler")
+	defer span.End()
+
+	requestID := requestIDFromRequest(r)
+	w.Header().Set(requestIDHeader, requestID)
+	ctx = withRequestID(ctx, requestID)
+
+	query := r.URL.Query()
+	if query.Get("lat") == "" || query.Get("lon") == "" {
+		responseWithError(w, r, http.StatusBadRequest, msgCoordsRequired)
+		return
+	}
+
+	lat, ok := parseCoordinate(query.Get("lat"), 90)
+	if !ok {
+		responseWithError(w, r, http.StatusUnprocessableEntity, errInvalidLatitude.Error())
+		return
+	}
+	lon, ok := parseCoordinate(query.Get("lon"), 180)
+	if !ok {
+		responseWithError(w, r, http.StatusUnprocessableEntity, errInvalidLongitude.Error())
+		return
+	}
+
+	units, err := s.parseUnits(query.Get("units"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidUnits)
+		return
+	}
+
+	extended, err := parseBoolParam(query.Get("extended"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidExtended)
+		return
+	}
+
+	lang := strings.ToLower(query.Get("lang"))
+	if lang != "" && !isSupportedLang(lang) {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidLang)
+		return
+	}
+
+	response, err := s.fetchTemperatureForCoords(ctx, lat, lon, lang)
+	if err != nil {
+		respondWithTemperatureError(w, r, err)
+		return
+	}
+	response.units = units
+	if !extended {
+		response.Conditions = nil
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(s.config.CacheMaxAge))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestCoordsTemperatureHandler(t *testing.T) {
+  var query string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host != "api.weatherapi.com" {
+      t.Errorf("Expected only WeatherAPI to be called, got %s", req.URL)
+    }
+    query = req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature/coords?lat=-23.55&lon=-46.63", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.coordsTemperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+  if query != "-23.55,-46.63" {
+    t.Errorf("Expected q %q, got %q", "-23.55,-46.63", query)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+  if response.TempC != 25.0 {
+    t.Errorf("Expected temp_C 25.0, got %v", response.TempC)
+  }
+  if response.City != "São Paulo" {
+    t.Errorf("Expected city São Paulo, got %q", response.City)
+  }
+}
+
+func TestCoordsTemperatureHandlerInvalidCoordinates(t *testing.T) {
+  tests := []struct {
+    name     string
+    query    string
+    status   int
+    expected string
+  }{
+    {"Missing lon", "lat=-23.55", http.StatusBadRequest, "os parâmetros lat e lon são obrigatórios"},
+    {"Latitude too low", "lat=-90.01&lon=-46.63", http.StatusUnprocessableEntity, "lat deve ser um número entre -90 e 90"},
+    {"Latitude too high", "lat=91&lon=-46.63", http.StatusUnprocessableEntity, "lat deve ser um número entre -90 e 90"},
+    {"Longitude too low", "lat=-23.55&lon=-181", http.StatusUnprocessableEntity, "lon deve ser um número entre -180 e 180"},
+    {"Longitude too high", "lat=-23.55&lon=180.5", http.StatusUnprocessableEntity, "lon deve ser um número entre -180 e 180"},
+    {"Not a number", "lat=south&lon=-46.63", http.StatusUnprocessableEntity, "lat deve ser um número entre -90 e 90"},
+    {"NaN", "lat=-23.55&lon=NaN", http.StatusUnprocessableEntity, "lon deve ser um número entre -180 e 180"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature/coords?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(NewServer(defaultConfig(), nil).coordsTemperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.status {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, tt.status)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.Message != tt.expected {
+        t.Errorf("Expected message %q, got %q", tt.expected, response.Message)
+      }
+    })
+  }
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestTemperatureHandlerETag(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  get := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest("GET", "/temperature?"+query, nil)
+    if ifNoneMatch != "" {
+      req.Header.Set("If-None-Match", ifNoneMatch)
+    }
+    rr := httptest.NewRecorder()
+    s.temperatureHandler(rr, req)
+    return rr
+  }
+
+  first := get("cep=01001000", "")
+  if first.Code != http.StatusOK {
+    t.Fatalf("Expected status %d, got %d", http.StatusOK, first.Code)
+  }
+  etag := first.Header().Get("ETag")
+  if !strings.HasPrefix(etag, `W/"`) {
+    t.Fatalf("Expected a weak ETag, got %q", etag)
+  }
+
+  if again := get("cep=01001000", "").Header().Get("ETag"); again != etag {
+    t.Errorf("Expected the same reading to keep its ETag %q, got %q", etag, again)
+  }
+  if other := get("cep=01001000&units=c", "").Header().Get("ETag"); other == etag {
+    t.Errorf("Expected a different representation to get a different ETag, got %q for both", etag)
+  }
+
+  notModified := get("cep=01001000", `"other", `+etag)
+  if notModified.Code != http.StatusNotModified {
+    t.Fatalf("Expected status %d, got %d", http.StatusNotModified, notModified.Code)
+  }
+  if notModified.Body.Len() != 0 {
+    t.Errorf("Expected an empty body, got %q", notModified.Body.String())
+  }
+  if got := notModified.Header().Get("ETag"); got != etag {
+    t.Errorf("Expected the 304 to repeat ETag %q, got %q", etag, got)
+  }
+  if cc := notModified.Header().Get("Cache-Control"); cc == "" {
+    t.Error("Expected the 304 to keep the Cache-Control header")
+  }
+
+  if stale := get("cep=01001000", `W/"0000000000000000"`); stale.Code != http.StatusOK {
+    t.Errorf("Expected status %d for a stale ETag, got %d", http.StatusOK, stale.Code)
+  }
+}
+
+func TestETagMatches(t *testing.T) {
+  etag := `W/"abc"`
+  tests := []struct {
+    ifNoneMatch string
+    expected    bool
+  }{
+    {"", false},
+    {`W/"abc"`, true},
+    {`"abc"`, true},
+    {`"xyz", W/"abc"`, true},
+    {`"xyz"`, false},
+    {"*", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.ifNoneMatch, func(t *testing.T) {
+      if got := etagMatches(tt.ifNoneMatch, etag); got != tt.expected {
+        t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, etag, got, tt.expected)
+      }
+    })
+  }
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	minForecastDays     = 1
+	maxForecastDays     = 3
+	defaultForecastDays = maxForecastDays
+)
+
+type DailyForecast struct {
+	Date     string  `json:"date"`
+	MinTempC float64 `json:"min_temp_C"`
+	MaxTempC float64 `json:"max_temp_C"`
+	MinTempF float64 `json:"min_temp_F"`
+	MaxTempF float64 `json:"max_temp_F"`
+	MinTempK float64 `json:"min_temp_K"`
+	MaxTempK float64 `json:"max_temp_K"`
+}
+
+type WeatherAPIForecastResponse struct {
+	Location struct {
+		Name    string `json:"name"`
+		Region  string `json:"region"`
+		Country string `json:"country"`
+	} `json:"location"`
+	Forecast struct {
+		ForecastDay []struct {
+			Date string `json:"date"`
+			Day  struct {
+				MinTempC float64 `json:"mintemp_c"`
+				MaxTempC float64 `json:"maxtemp_c"`
+			} `json:"day"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+// parseForecastDays validates the optional days query parameter, returning
+// the default when it is omitted.
+func parseForecastDays(value string) (int, error) {
+	if value == "" {
+		return defaultForecastDays, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < minForecastDays || days > maxForecastDays {
+		return 0, fmt.Errorf("days must be between %d and %d", minForecastDays, maxForecastDays)
+	}
+
+	return days, nil
+}
+
+func (s *Server) getForecastFromLocation(ctx context.Context, city string, days int) (*WeatherAPIForecastResponse, error) {
+	query := url.Values{}
+	query.Set("q", city)
+	query.Set("days", strconv.Itoa(days))
+	query.Set("aqi", "no")
+	query.Set("alerts", "no")
+
+	resp, err := s.doWeatherRequest(ctx, "/forecast.json", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := readUpstreamBody(resp.Body, s.config.MaxUpstreamBodyBytes)
+	if err != nil {
+		recordUpstreamFailure(providerWeatherAPI)
+		return nil, &UpstreamError{Provider: providerWeatherAPI, Err: err}
+	}
+
+	var forecastResponse WeatherAPIForecastResponse
+	if err := json.Unmarshal(data, &forecastResponse); err != nil {
+		recordUpstreamFailure(providerWeatherAPI)
+		return nil, &UpstreamError{Provider: providerWeatherAPI, Err: invalidBodyError(fmt.Sprintf("city %q", city), err)}
+	}
+
+	return &forecastResponse, nil
+}
+
+func (s *Server) forecastHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFromRequest(r)
+	w.Header().Set(requestIDHeader, requestID)
+	ctx := withRequestID(r.Context(), requestID)
+
+	cep := normalizeCEP(r.URL.Query().Get("cep"))
+	reqLogger := loggerFromContext(ctx).With("cep", cep)
+	if cep == "" {
+		responseWithError(w, r, http.StatusBadRequest, msgCEPRequired)
+		return
+	}
+
+	if err := validateCEP(cep); err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	days, err := parseForecastDays(r.URL.Query().Get("days"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidDays)
+		return
+	}
+
+	location, err := s.resolveLocation(ctx, cep)
+	if err != nil {
+		respondWithTemperatureError(w, r, err)
+		return
+	}
+
+	forecast, err := s.getForecastFromLocation(ctx, location.Localidade, days)
+	if err != nil {
+		respondWithTemperatureError(w, r, s.weatherError(reqLogger.With("city", location.Localidade), err, msgZipcodeNotFound, msgForecastFailed))
+		return
+	}
+
+	response := make([]DailyForecast, 0, len(forecast.Forecast.ForecastDay))
+	for _, day := range forecast.Forecast.ForecastDay {
+		response = append(response, DailyForecast{
+			Date:     day.Date,
+			MinTempC: day.Day.MinTempC,
+			MaxTempC: day.Day.MaxTempC,
+			MinTempF: celsiusToFahrenheit(day.Day.MinTempC),
+			MaxTempF: celsiusToFahrenheit(day.Day.MaxTempC),
+			MinTempK: s.toKelvin(day.Day.MinTempC),
+			MaxTempK: s.toKelvin(day.Day.MaxTempC),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
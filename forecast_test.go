@@ -0,0 +1,146 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+const mockForecastResponse = `{
+  "location": {
+    "name": "São Paulo",
+    "region": "Sao Paulo",
+    "country": "Brazil"
+  },
+  "forecast": {
+    "forecastday": [
+      {"date": "2024-01-02", "day": {"mintemp_c": 18.0, "maxtemp_c": 28.0}},
+      {"date": "2024-01-03", "day": {"mintemp_c": 17.0, "maxtemp_c": 26.0}}
+    ]
+  }
+}`
+
+func TestParseForecastDays(t *testing.T) {
+  tests := []struct {
+    name     string
+    value    string
+    expected int
+    wantErr  bool
+  }{
+    {"Default", "", defaultForecastDays, false},
+    {"Minimum", "1", 1, false},
+    {"Maximum", "3", 3, false},
+    {"Too Low", "0", 0, true},
+    {"Too High", "4", 0, true},
+    {"Not A Number", "two", 0, true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      result, err := parseForecastDays(tt.value)
+      if (err != nil) != tt.wantErr {
+        t.Fatalf("parseForecastDays(%q) error = %v; wantErr %v", tt.value, err, tt.wantErr)
+      }
+      if result != tt.expected {
+        t.Errorf("parseForecastDays(%q) = %d; want %d", tt.value, result, tt.expected)
+      }
+    })
+  }
+}
+
+func TestGetForecastFromLocation(t *testing.T) {
+  var requestedURL string
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    requestedURL = req.URL.String()
+    return mockResponse(http.StatusOK, mockForecastResponse), nil
+  })
+
+  forecast, err := NewServer(testConfig(), mockClient).getForecastFromLocation(context.Background(), "Recife", 2)
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if !strings.Contains(requestedURL, "forecast.json") || !strings.Contains(requestedURL, "days=2") {
+    t.Errorf("Expected a forecast request for 2 days, got %s", requestedURL)
+  }
+
+  if len(forecast.Forecast.ForecastDay) != 2 {
+    t.Errorf("Expected 2 forecast days, got %d", len(forecast.Forecast.ForecastDay))
+  }
+}
+
+func TestForecastHandlerSuccess(t *testing.T) {
+  s := NewServer(testConfig(), &MockHTTPClient{
+    DoFunc: func(req *http.Request) (*http.Response, error) {
+      if strings.Contains(req.URL.String(), "viacep.com.br") {
+        return mockResponse(http.StatusOK, `{"cep": "01001-000", "localidade": "São Paulo", "uf": "SP"}`), nil
+      }
+      return mockResponse(http.StatusOK, mockForecastResponse), nil
+    },
+  })
+
+  req, err := http.NewRequest("GET", "/forecast?cep=01001000&days=2", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.forecastHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  var response []DailyForecast
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if len(response) != 2 {
+    t.Fatalf("Expected 2 forecast days, got %d", len(response))
+  }
+
+  first := response[0]
+  if first.Date != "2024-01-02" {
+    t.Errorf("Expected date to be 2024-01-02, got %s", first.Date)
+  }
+
+  if first.MinTempC != 18.0 || first.MaxTempC != 28.0 {
+    t.Errorf("Expected min/max 18/28 C, got %f/%f", first.MinTempC, first.MaxTempC)
+  }
+
+  if first.MaxTempF != celsiusToFahrenheit(28.0) {
+    t.Errorf("Expected max_temp_F to be %f, got %f", celsiusToFahrenheit(28.0), first.MaxTempF)
+  }
+
+  if first.MinTempK != celsiusToKelvin(18.0) {
+    t.Errorf("Expected min_temp_K to be %f, got %f", celsiusToKelvin(18.0), first.MinTempK)
+  }
+}
+
+func TestForecastHandlerInvalidDays(t *testing.T) {
+  req, err := http.NewRequest("GET", "/forecast?cep=01001000&days=5", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).forecastHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "days inválido"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest body worth compressing; below it the gzip
+// framing outweighs the savings.
+const gzipMinSize = 1024
+
+// gzipMiddleware compresses responses of at least gzipMinSize bytes for
+// clients that send Accept-Encoding: gzip. Responses that already carry a
+// Content-Encoding (such as /metrics) are passed through untouched.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// close is not deferred so a panic leaves the response unwritten
+		// for recoverMiddleware.
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(gw, r)
+		gw.close()
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, i.e.
+// lists it (or *) without q=0.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the first gzipMinSize bytes of a response to
+// decide whether it is worth compressing, then streams the rest.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	started bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.started || gw.status != 0 {
+		return
+	}
+	gw.status = status
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.gz != nil {
+		return gw.gz.Write(p)
+	}
+	if gw.started {
+		return gw.ResponseWriter.Write(p)
+	}
+
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= gzipMinSize {
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start sends the headers and the buffered bytes, compressing them when
+// compress is set and the handler didn't choose its own encoding.
+func (gw *gzipResponseWriter) start(compress bool) error {
+	gw.started = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	header := gw.ResponseWriter.Header()
+	if compress && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		gw.ResponseWriter.WriteHeader(gw.status)
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+		_, err := gw.gz.Write(gw.buf)
+		return err
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+	_, err := gw.ResponseWriter.Write(gw.buf)
+	return err
+}
+
+// close flushes a response that never reached gzipMinSize uncompressed, or
+// finishes the gzip stream.
+func (gw *gzipResponseWriter) close() {
+	if !gw.started {
+		gw.start(false)
+		return
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
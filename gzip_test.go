@@ -0,0 +1,184 @@
+package main
+
+import (
+  "compress/gzip"
+  "encoding/json"
+  "io"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+  tests := []struct {
+    acceptEncoding string
+    expected       bool
+  }{
+    {"", false},
+    {"gzip", true},
+    {"deflate, gzip;q=0.8", true},
+    {"GZIP", true},
+    {"*", true},
+    {"gzip;q=0", false},
+    {"br, deflate", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.acceptEncoding, func(t *testing.T) {
+      if got := acceptsGzip(tt.acceptEncoding); got != tt.expected {
+        t.Errorf("acceptsGzip(%q) = %v, want %v", tt.acceptEncoding, got, tt.expected)
+      }
+    })
+  }
+}
+
+func TestGzipMiddleware(t *testing.T) {
+  large := map[string]string{"data": strings.Repeat("temperature ", 200)}
+  small := map[string]string{"data": "temperature"}
+
+  tests := []struct {
+    name           string
+    acceptEncoding string
+    body           map[string]string
+    wantGzip       bool
+  }{
+    {"Large Body", "gzip", large, true},
+    {"Small Body", "gzip", small, false},
+    {"No Accept-Encoding", "", large, false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(tt.body)
+      }))
+
+      req, err := http.NewRequest("GET", "/", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.acceptEncoding != "" {
+        req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+      }
+
+      rr := httptest.NewRecorder()
+      handler.ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusCreated {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+      }
+
+      if vary := rr.Header().Get("Vary"); vary != "Accept-Encoding" {
+        t.Errorf("Expected Vary: Accept-Encoding, got %q", vary)
+      }
+
+      var reader io.Reader = rr.Body
+      encoding := rr.Header().Get("Content-Encoding")
+      if tt.wantGzip {
+        if encoding != "gzip" {
+          t.Fatalf("Expected Content-Encoding gzip, got %q", encoding)
+        }
+        gz, err := gzip.NewReader(rr.Body)
+        if err != nil {
+          t.Fatalf("Failed to read gzip body: %v", err)
+        }
+        reader = gz
+      } else if encoding != "" {
+        t.Fatalf("Expected no Content-Encoding, got %q", encoding)
+      }
+
+      var response map[string]string
+      if err := json.NewDecoder(reader).Decode(&response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if response["data"] != tt.body["data"] {
+        t.Errorf("handler returned unexpected body: got %v want %v", response, tt.body)
+      }
+    })
+  }
+}
+
+func TestGzipMiddlewareKeepsExistingEncoding(t *testing.T) {
+  body := strings.Repeat("x", 2*gzipMinSize)
+  handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Encoding", "br")
+    w.Write([]byte(body))
+  }))
+
+  req, err := http.NewRequest("GET", "/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  req.Header.Set("Accept-Encoding", "gzip, br")
+
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, req)
+
+  if encoding := rr.Header().Get("Content-Encoding"); encoding != "br" {
+    t.Errorf("Expected Content-Encoding br to be kept, got %q", encoding)
+  }
+
+  if rr.Body.String() != body {
+    t.Errorf("Expected body to be passed through unchanged")
+  }
+}
+
+func TestRoutesKeepGzipVary(t *testing.T) {
+  ceps := make([]string, maxBatchCEPs)
+  for i := range ceps {
+    ceps[i] = "123"
+  }
+  body, err := json.Marshal(map[string][]string{"ceps": ceps})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    name     string
+    method   string
+    target   string
+    body     string
+    headers  map[string]string
+    status   int
+    expected []string
+  }{
+    {"Batch", "POST", "/temperature/batch", string(body), nil, http.StatusOK, []string{"Accept-Encoding", "Accept-Language"}},
+    {"Temperature", "GET", "/temperature?cep=01001000", "", nil, http.StatusOK, []string{"Accept-Encoding", "Accept"}},
+    {"Not Modified", "GET", "/temperature?cep=01001000", "", map[string]string{"If-None-Match": "*"}, http.StatusNotModified, []string{"Accept-Encoding", "Accept"}},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+      req.Header.Set("Accept-Encoding", "gzip")
+      for key, value := range tt.headers {
+        req.Header.Set(key, value)
+      }
+
+      rr := httptest.NewRecorder()
+      s.routes().ServeHTTP(rr, req)
+
+      if rr.Code != tt.status {
+        t.Fatalf("Expected status %d, got %d", tt.status, rr.Code)
+      }
+      vary := rr.Header().Values("Vary")
+      for _, expected := range tt.expected {
+        found := false
+        for _, value := range vary {
+          if value == expected {
+            found = true
+          }
+        }
+        if !found {
+          t.Errorf("Expected Vary to include %q, got %q", expected, vary)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	langPtBR = "pt-BR"
+	langEn   = "en"
+)
+
+// defaultErrorLanguages are offered when ERROR_LANGUAGES is unset. Most
+// users are Brazilian, so Portuguese comes first and is the fallback.
+var defaultErrorLanguages = []string{langPtBR, langEn}
+
+// Error messages sent to clients, in English. Handlers report them through
+// these constants, which key the translations in errorMessageBundles.
+const (
+	msgCEPRequired        = "CEP parameter is required"
+	msgCityNotFound       = "can not find city"
+	msgIBGENotFound       = "can not find ibge code"
+	msgCoordsNotFound     = "can not find location for coordinates"
+	msgClientIPNotFound   = "can not find location for ip"
+	msgZipcodeNotFound    = "can not find zipcode"
+	msgLocationsExclusive = "cep, city and ibge are mutually exclusive"
+	msgLocationRequired   = "cep, city or ibge parameter is required"
+	msgCEPsRequired       = "ceps is required"
+	msgCityBlank          = "city must not be blank"
+	msgForecastFailed     = "failed to get forecast data"
+	msgTemperatureFailed  = "failed to get temperature data"
+	msgIBGEFailed         = "failed to resolve ibge code"
+	msgZipcodeFailed      = "failed to resolve zipcode"
+	msgIBGELength         = "ibge code must be 7 digits"
+	msgInternalError      = "internal server error"
+	msgInvalidAddress     = "invalid address"
+	msgInvalidAQI         = "invalid aqi"
+	msgInvalidClientIP    = "invalid client ip"
+	msgInvalidDays        = "invalid days"
+	msgInvalidExtended    = "invalid extended"
+	msgInvalidFormat      = "invalid format"
+	msgInvalidFrom        = "invalid from"
+	msgInvalidLang        = "invalid lang"
+	msgInvalidNoCache     = "invalid nocache"
+	msgInvalidNotation    = "invalid notation"
+	msgInvalidPartial     = "invalid partial"
+	msgInvalidPretty      = "invalid pretty"
+	msgInvalidBody        = "invalid request body"
+	msgInvalidSource      = "invalid source"
+	msgInvalidTo          = "invalid to"
+	msgInvalidUnits       = "invalid units"
+	msgInvalidValue       = "invalid value"
+	msgCoordsRequired     = "lat and lon parameters are required"
+	msgInvalidLatitude    = "lat must be a number between -90 and 90"
+	msgInvalidLongitude   = "lon must be a number between -180 and 180"
+	msgMethodNotAllowed   = "method not allowed"
+	msgBodyTooLarge       = "request body too large"
+	msgTimedOut           = "request timed out"
+	msgCancelled          = "request cancelled"
+	msgBusy               = "service busy, try again later"
+	msgMisconfigured      = "service misconfigured"
+	msgSourceIPCombined   = "source=ip can not be combined with cep, city or ibge"
+	msgTooManyCEPs        = "too many ceps"
+	msgAbovePlanck        = "value above the Planck temperature"
+	msgBelowAbsoluteZero  = "value below absolute zero"
+	msgWeatherUnavailable = "weather service temporarily unavailable"
+	msgCEPLength          = "zipcode must be 8 digits"
+	msgCEPNotDigits       = "zipcode must contain only digits"
+	msgZipcodeRateLimited = "zipcode service rate limited, try again later"
+	msgStateNotAllowed    = "zipcode state not allowed"
+)
+
+// errorMessageBundles maps each supported language to the translations of
+// the error messages. Messages are written in English, so its bundle is
+// empty; a message missing from a bundle is sent as it is.
+var errorMessageBundles = map[string]map[string]string{
+	langEn: {},
+	langPtBR: {
+		msgCEPRequired:        "o parâmetro cep é obrigatório",
+		msgCityNotFound:       "não foi possível encontrar a cidade",
+		msgIBGENotFound:       "não foi possível encontrar o código IBGE",
+		msgCoordsNotFound:     "não foi possível encontrar a localização das coordenadas",
+		msgClientIPNotFound:   "não foi possível encontrar a localização do IP",
+		msgZipcodeNotFound:    "não foi possível encontrar o CEP",
+		msgLocationsExclusive: "cep, city e ibge são mutuamente exclusivos",
+		msgLocationRequired:   "o parâmetro cep, city ou ibge é obrigatório",
+		msgCEPsRequired:       "ceps é obrigatório",
+		msgCityBlank:          "city não pode estar em branco",
+		msgForecastFailed:     "falha ao obter a previsão do tempo",
+		msgTemperatureFailed:  "falha ao obter os dados de temperatura",
+		msgIBGEFailed:         "falha ao consultar o código IBGE",
+		msgZipcodeFailed:      "falha ao consultar o CEP",
+		msgIBGELength:         "o código IBGE deve ter 7 dígitos",
+		msgInternalError:      "erro interno do servidor",
+		msgInvalidAddress:     "endereço inválido",
+		msgInvalidAQI:         "aqi inválido",
+		msgInvalidClientIP:    "IP do cliente inválido",
+		msgInvalidDays:        "days inválido",
+		msgInvalidExtended:    "extended inválido",
+		msgInvalidFormat:      "format inválido",
+		msgInvalidFrom:        "from inválido",
+		msgInvalidLang:        "lang inválido",
+		msgInvalidNoCache:     "nocache inválido",
+		msgInvalidNotation:    "notation inválido",
+		msgInvalidPartial:     "partial inválido",
+		msgInvalidPretty:      "pretty inválido",
+		msgInvalidBody:        "corpo da requisição inválido",
+		msgInvalidSource:      "source inválido",
+		msgInvalidTo:          "to inválido",
+		msgInvalidUnits:       "units inválido",
+		msgInvalidValue:       "valor inválido",
+		msgCoordsRequired:     "os parâmetros lat e lon são obrigatórios",
+		msgInvalidLatitude:    "lat deve ser um número entre -90 e 90",
+		msgInvalidLongitude:   "lon deve ser um número entre -180 e 180",
+		msgMethodNotAllowed:   "método não permitido",
+		msgBodyTooLarge:       "corpo da requisição grande demais",
+		msgTimedOut:           "tempo limite da requisição esgotado",
+		msgCancelled:          "requisição cancelada",
+		msgBusy:               "serviço ocupado, tente novamente mais tarde",
+		msgMisconfigured:      "serviço configurado incorretamente",
+		msgSourceIPCombined:   "source=ip não pode ser combinado com cep, city ou ibge",
+		msgTooManyCEPs:        "ceps demais",
+		msgAbovePlanck:        "valor acima da temperatura de Planck",
+		msgBelowAbsoluteZero:  "valor abaixo do zero absoluto",
+		msgWeatherUnavailable: "serviço de clima temporariamente indisponível",
+		msgCEPLength:          "o CEP deve ter 8 dígitos",
+		msgCEPNotDigits:       "o CEP deve conter apenas dígitos",
+		msgZipcodeRateLimited: "limite de requisições do serviço de CEP atingido, tente novamente mais tarde",
+		msgStateNotAllowed:    "estado do CEP não permitido",
+	},
+}
+
+// errorLanguage picks the language of the error messages sent to a client
+// from its Accept-Language header, choosing among supported. The first
+// supported language is used when the header matches none of them; with no
+// languages configured messages stay in English.
+func errorLanguage(acceptLanguage string, supported []string) string {
+	if len(supported) == 0 {
+		return langEn
+	}
+
+	tags := make([]language.Tag, len(supported))
+	for i, lang := range supported {
+		tags[i] = language.Make(lang)
+	}
+
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(preferred) == 0 {
+		return supported[0]
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(preferred...)
+	if confidence == language.No {
+		return supported[0]
+	}
+	return supported[index]
+}
+
+// translateError returns message in lang, or message itself when lang has
+// no translation for it.
+func translateError(lang, message string) string {
+	if translated, ok := errorMessageBundles[lang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+type errorLanguageKey struct{}
+
+// withErrorLanguages picks each request's error language among supported,
+// ERROR_LANGUAGES, for errorLanguageFromRequest.
+func withErrorLanguages(supported []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lang := errorLanguage(r.Header.Get("Accept-Language"), supported)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorLanguageKey{}, lang)))
+		})
+	}
+}
+
+// errorLanguageFromRequest returns the error language withErrorLanguages
+// picked for r, or picks one among defaultErrorLanguages when r didn't go
+// through it.
+func errorLanguageFromRequest(r *http.Request) string {
+	if lang, ok := r.Context().Value(errorLanguageKey{}).(string); ok {
+		return lang
+	}
+	return errorLanguage(r.Header.Get("Accept-Language"), defaultErrorLanguages)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestErrorLanguage(t *testing.T) {
+  supported := []string{langPtBR, langEn}
+
+  tests := []struct {
+    name           string
+    acceptLanguage string
+    supported      []string
+    expected       string
+  }{
+    {"No Header", "", supported, langPtBR},
+    {"Portuguese", "pt-BR", supported, langPtBR},
+    {"Bare Portuguese", "pt", supported, langPtBR},
+    {"English", "en", supported, langEn},
+    {"Regional English", "en-US,en;q=0.9", supported, langEn},
+    {"Quality Order", "pt-BR;q=0.5, en;q=0.8", supported, langEn},
+    {"Unsupported", "fr-FR", supported, langPtBR},
+    {"Malformed", "??;q=x", supported, langPtBR},
+    {"English Default", "de", []string{langEn, langPtBR}, langEn},
+    {"English Only", "pt-BR", []string{langEn}, langEn},
+    {"None Configured", "pt-BR", nil, langEn},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if lang := errorLanguage(tt.acceptLanguage, tt.supported); lang != tt.expected {
+        t.Errorf("Expected %q, got %q", tt.expected, lang)
+      }
+    })
+  }
+}
+
+func TestTranslateError(t *testing.T) {
+  if message := translateError(langPtBR, "can not find zipcode"); message != "não foi possível encontrar o CEP" {
+    t.Errorf("Expected the Portuguese message, got %q", message)
+  }
+  if message := translateError(langEn, "can not find zipcode"); message != "can not find zipcode" {
+    t.Errorf("Expected the English message, got %q", message)
+  }
+  if message := translateError(langPtBR, "something new"); message != "something new" {
+    t.Errorf("Expected an untranslated message to be kept, got %q", message)
+  }
+}
+
+// TestErrorMessagesTranslated checks every error message has a Portuguese
+// translation, and that the bundle translates nothing else.
+func TestErrorMessagesTranslated(t *testing.T) {
+  messages := []string{
+    msgCEPRequired, msgCityNotFound, msgIBGENotFound, msgCoordsNotFound, msgClientIPNotFound,
+    msgZipcodeNotFound, msgLocationsExclusive, msgLocationRequired, msgCEPsRequired, msgCityBlank,
+    msgForecastFailed, msgTemperatureFailed, msgIBGEFailed, msgZipcodeFailed, msgIBGELength,
+    msgInternalError, msgInvalidAddress, msgInvalidAQI, msgInvalidClientIP, msgInvalidDays,
+    msgInvalidExtended, msgInvalidFormat, msgInvalidFrom, msgInvalidLang, msgInvalidNoCache,
+    msgInvalidNotation, msgInvalidPartial, msgInvalidPretty, msgInvalidBody, msgInvalidSource,
+    msgInvalidTo, msgInvalidUnits, msgInvalidValue, msgCoordsRequired, msgInvalidLatitude,
+    msgInvalidLongitude, msgMethodNotAllowed, msgBodyTooLarge, msgTimedOut, msgCancelled,
+    msgBusy, msgMisconfigured, msgSourceIPCombined, msgTooManyCEPs, msgAbovePlanck,
+    msgBelowAbsoluteZero, msgWeatherUnavailable, msgCEPLength, msgCEPNotDigits,
+    msgZipcodeRateLimited, msgStateNotAllowed,
+  }
+
+  for _, message := range messages {
+    if translateError(langPtBR, message) == message {
+      t.Errorf("Expected a Portuguese translation for %q", message)
+    }
+  }
+  if len(errorMessageBundles[langPtBR]) != len(messages) {
+    t.Errorf("Expected %d Portuguese translations, got %d", len(messages), len(errorMessageBundles[langPtBR]))
+  }
+}
+
+func TestTemperatureHandlerInvalidCEPLanguages(t *testing.T) {
+  tests := []struct {
+    name           string
+    acceptLanguage string
+    cep            string
+    expected       string
+    expectedLang   string
+  }{
+    {"Default Length", "", "123", "o CEP deve ter 8 dígitos", langPtBR},
+    {"Default Digits", "", "0100100a", "o CEP deve conter apenas dígitos", langPtBR},
+    {"Portuguese", "pt-BR,pt;q=0.9", "123", "o CEP deve ter 8 dígitos", langPtBR},
+    {"English Length", "en-US,en;q=0.9", "123", "zipcode must be 8 digits", langEn},
+    {"English Digits", "en", "0100100a", "zipcode must contain only digits", langEn},
+    {"Unsupported", "fr", "123", "o CEP deve ter 8 dígitos", langPtBR},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "/temperature?cep="+tt.cep, nil)
+      if tt.acceptLanguage != "" {
+        req.Header.Set("Accept-Language", tt.acceptLanguage)
+      }
+      rr := httptest.NewRecorder()
+      NewServer(testConfig(), nil).temperatureHandler(rr, req)
+
+      if rr.Code != http.StatusUnprocessableEntity {
+        t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+      }
+      if lang := rr.Header().Get("Content-Language"); lang != tt.expectedLang {
+        t.Errorf("Expected Content-Language %q, got %q", tt.expectedLang, lang)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.Message != tt.expected {
+        t.Errorf("Expected message %q, got %q", tt.expected, response.Message)
+      }
+    })
+  }
+}
+
+func TestBatchTemperatureHandlerErrorLanguages(t *testing.T) {
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "brasilapi.com.br" {
+      return mockResponse(http.StatusNotFound, `{}`), nil
+    }
+    return mockResponse(http.StatusOK, `{"erro": true}`), nil
+  }))
+
+  tests := []struct {
+    name           string
+    acceptLanguage string
+    expected       []string
+    expectedLang   string
+  }{
+    {"Default", "", []string{"o CEP deve ter 8 dígitos", "não foi possível encontrar o CEP"}, langPtBR},
+    {"English", "en", []string{"zipcode must be 8 digits", "can not find zipcode"}, langEn},
+    {"Unsupported", "fr-FR", []string{"o CEP deve ter 8 dígitos", "não foi possível encontrar o CEP"}, langPtBR},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("POST", "/temperature/batch", strings.NewReader(`{"ceps": ["123", "99999999"]}`))
+      if tt.acceptLanguage != "" {
+        req.Header.Set("Accept-Language", tt.acceptLanguage)
+      }
+      rr := httptest.NewRecorder()
+      s.batchTemperatureHandler(rr, req)
+
+      if lang := rr.Header().Get("Content-Language"); lang != tt.expectedLang {
+        t.Errorf("Expected Content-Language %q, got %q", tt.expectedLang, lang)
+      }
+
+      var results []BatchTemperatureResult
+      if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if len(results) != len(tt.expected) {
+        t.Fatalf("Expected %d results, got %d", len(tt.expected), len(results))
+      }
+      for i, expected := range tt.expected {
+        if results[i].Error == nil || results[i].Error.Message != expected {
+          t.Errorf("result %d: expected message %q, got %+v", i, expected, results[i].Error)
+        }
+      }
+    })
+  }
+}
+
+func TestPartialTemperatureErrorLanguages(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = 0
+
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusInternalServerError, `{}`), nil
+  }))
+
+  tests := []struct {
+    name           string
+    acceptLanguage string
+    expected       string
+    expectedLang   string
+  }{
+    {"Default", "", "falha ao obter os dados de temperatura", langPtBR},
+    {"English", "en-US", "failed to get temperature data", langEn},
+    {"Unsupported", "de", "falha ao obter os dados de temperatura", langPtBR},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "/temperature?cep=01001000&partial=true", nil)
+      if tt.acceptLanguage != "" {
+        req.Header.Set("Accept-Language", tt.acceptLanguage)
+      }
+      rr := httptest.NewRecorder()
+      s.temperatureHandler(rr, req)
+
+      if rr.Code != http.StatusOK {
+        t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+      }
+      if lang := rr.Header().Get("Content-Language"); lang != tt.expectedLang {
+        t.Errorf("Expected Content-Language %q, got %q", tt.expectedLang, lang)
+      }
+
+      var response PartialTemperatureResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.WeatherError != tt.expected {
+        t.Errorf("Expected weather_error %q, got %q", tt.expected, response.WeatherError)
+      }
+    })
+  }
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultIBGEBaseURL = "https://servicodados.ibge.gov.br/api/v1/localidades"
+
+// ErrMunicipalityNotFound means IBGE has no municipality with the code.
+var ErrMunicipalityNotFound = errors.New("municipality not found")
+
+var (
+	errIBGECode     = errors.New(msgIBGELength)
+	ibgeCodePattern = regexp.MustCompile(`^\d{7}$`)
+)
+
+// IBGEMunicipality is the part of IBGE's localidades/municipios response we
+// use.
+type IBGEMunicipality struct {
+	ID   int    `json:"id"`
+	Nome string `json:"nome"`
+}
+
+// validateIBGECode checks that code is a 7-digit IBGE municipality code.
+func validateIBGECode(code string) error {
+	if !ibgeCodePattern.MatchString(code) {
+		return errIBGECode
+	}
+	return nil
+}
+
+// getCityFromIBGE resolves an IBGE municipality code to the municipality's
+// name.
+func (s *Server) getCityFromIBGE(ctx context.Context, code string) (city string, err error) {
+	ctx, span := startSpan(ctx, "ibge.lookup", attribute.String("ibge", code))
+	defer func() { endSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/municipios/%s", s.config.IBGEBaseURL, code)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	prepareUpstreamRequest(ctx, req, s.config.UserAgent)
+
+	release, err := s.upstreamSlots.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	resp, err := doUpstream(providerIBGE, s.client, s.retryJitter, req)
+	if err != nil {
+		recordUpstreamFailure(providerIBGE)
+		return "", &UpstreamError{Provider: providerIBGE, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrMunicipalityNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		recordUpstreamFailure(providerIBGE)
+		return "", &UpstreamError{Provider: providerIBGE, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(limitUpstreamBody(resp.Body, s.config.MaxUpstreamBodyBytes))
+	if err != nil {
+		recordUpstreamFailure(providerIBGE)
+		return "", &UpstreamError{Provider: providerIBGE, Err: err}
+	}
+
+	// IBGE answers unknown codes with 200 and an empty list instead of an
+	// object.
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		return "", ErrMunicipalityNotFound
+	}
+
+	var municipality IBGEMunicipality
+	if err := json.Unmarshal(body, &municipality); err != nil {
+		recordUpstreamFailure(providerIBGE)
+		return "", &UpstreamError{Provider: providerIBGE, Err: invalidBodyError(fmt.Sprintf("ibge code %q", code), err)}
+	}
+
+	if municipality.Nome == "" {
+		return "", ErrMunicipalityNotFound
+	}
+
+	return municipality.Nome, nil
+}
+
+// fetchTemperatureForIBGE resolves a validated IBGE code to its municipality
+// and current temperature. Failures are returned as *temperatureError.
+func (s *Server) fetchTemperatureForIBGE(ctx context.Context, code, lang string) (*TemperatureResponse, error) {
+	reqLogger := loggerFromContext(ctx).With("ibge", code)
+
+	city, err := s.getCityFromIBGE(ctx, code)
+	if errors.Is(err, errUpstreamBusy) {
+		reqLogger.Warn("no upstream slot available for IBGE lookup")
+		return nil, &temperatureError{Status: http.StatusServiceUnavailable, Message: msgBusy, Err: err, RetryAfter: s.upstreamSlots.retryAfter()}
+	}
+	if errors.Is(err, ErrMunicipalityNotFound) {
+		reqLogger.Info("IBGE code not found")
+		return nil, &temperatureError{Status: http.StatusNotFound, Message: msgIBGENotFound, Err: err}
+	}
+	if err != nil {
+		reqLogger.Error("IBGE lookup failed", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusBadGateway, Message: msgIBGEFailed, Err: err}
+	}
+
+	return s.fetchTemperatureForCity(ctx, city, lang, msgIBGENotFound)
+}
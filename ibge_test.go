@@ -0,0 +1,151 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+const mockIBGEBody = `{"id": 3550308, "nome": "São Paulo", "microrregiao": {"id": 35061, "nome": "São Paulo"}}`
+
+func TestValidateIBGECode(t *testing.T) {
+  tests := []struct {
+    code  string
+    valid bool
+  }{
+    {"3550308", true},
+    {"355030", false},
+    {"35503081", false},
+    {"355030a", false},
+    {"", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.code, func(t *testing.T) {
+      if err := validateIBGECode(tt.code); (err == nil) != tt.valid {
+        t.Errorf("validateIBGECode(%q) = %v; want valid=%v", tt.code, err, tt.valid)
+      }
+    })
+  }
+}
+
+func TestGetCityFromIBGE(t *testing.T) {
+  tests := []struct {
+    name         string
+    status       int
+    body         string
+    expectedCity string
+    expectedErr  error
+  }{
+    {"Found", http.StatusOK, mockIBGEBody, "São Paulo", nil},
+    {"Unknown Code", http.StatusOK, `[]`, "", ErrMunicipalityNotFound},
+    {"Not Found Status", http.StatusNotFound, ``, "", ErrMunicipalityNotFound},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      var requestedURL string
+      mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        requestedURL = req.URL.String()
+        return mockResponse(tt.status, tt.body), nil
+      })
+
+      city, err := NewServer(testConfig(), mockClient).getCityFromIBGE(context.Background(), "3550308")
+      if !errors.Is(err, tt.expectedErr) {
+        t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+      }
+      if city != tt.expectedCity {
+        t.Errorf("Expected city %q, got %q", tt.expectedCity, city)
+      }
+
+      if expected := defaultIBGEBaseURL + "/municipios/3550308"; requestedURL != expected {
+        t.Errorf("Expected request to %s, got %s", expected, requestedURL)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerIBGE(t *testing.T) {
+  var weatherQuery string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    switch req.URL.Host {
+    case "servicodados.ibge.gov.br":
+      return mockResponse(http.StatusOK, mockIBGEBody), nil
+    case "api.weatherapi.com":
+      weatherQuery = req.URL.Query().Get("q")
+      return mockResponse(http.StatusOK, mockWeatherBody), nil
+    }
+    t.Errorf("Unexpected request to %s", req.URL.Host)
+    return mockResponse(http.StatusNotFound, ``), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?ibge=3550308", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if weatherQuery != "São Paulo" {
+    t.Errorf("Expected WeatherAPI to be queried for São Paulo, got %q", weatherQuery)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.TempC != 25.0 || response.City != "São Paulo" {
+    t.Errorf("Expected 25 C in São Paulo, got %v C in %q", response.TempC, response.City)
+  }
+}
+
+func TestTemperatureHandlerIBGEErrors(t *testing.T) {
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, `[]`), nil
+  }))
+
+  tests := []struct {
+    name            string
+    ibge            string
+    expectedStatus  int
+    expectedMessage string
+  }{
+    {"Too Short", "355030", http.StatusUnprocessableEntity, "o código IBGE deve ter 7 dígitos"},
+    {"Letters", "355030a", http.StatusUnprocessableEntity, "o código IBGE deve ter 7 dígitos"},
+    {"Unknown Code", "9999999", http.StatusNotFound, "não foi possível encontrar o código IBGE"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?ibge="+tt.ibge, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expectedStatus {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+const defaultCacheSweepInterval = 5 * time.Minute
+
+// cacheSweeper is a cache that can drop its expired entries on demand.
+type cacheSweeper interface {
+	sweep() int
+}
+
+// runCacheJanitor sweeps caches every interval until ctx is cancelled.
+// Lookups only evict the entry they touch, so without it a key that is never
+// asked for again would hold its memory forever. An interval of zero or less
+// disables sweeping and returns at once.
+func runCacheJanitor(ctx context.Context, interval time.Duration, caches ...cacheSweeper) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed := 0
+			for _, cache := range caches {
+				removed += cache.sweep()
+			}
+			if removed > 0 {
+				logger.Debug("evicted expired cache entries", "count", removed)
+			}
+		}
+	}
+}
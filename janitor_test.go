@@ -0,0 +1,96 @@
+package main
+
+import (
+  "context"
+  "testing"
+  "time"
+)
+
+func TestCacheSweepRemovesExpiredEntries(t *testing.T) {
+  clock := &fakeClock{now: time.Now()}
+
+  weather := newWeatherCache(time.Minute)
+  weather.clock = clock
+  locations := newLocationCache(time.Hour)
+  locations.clock = clock
+
+  weather.store("old", &WeatherAPIResponse{})
+  locations.store("01001000", &ViaCEPResponse{})
+  clock.advance(30 * time.Second)
+  weather.store("fresh", &WeatherAPIResponse{})
+  clock.advance(45 * time.Second)
+
+  if removed := weather.sweep(); removed != 1 {
+    t.Errorf("Expected 1 expired weather entry removed, got %d", removed)
+  }
+  if _, ok := weather.entries["old"]; ok {
+    t.Error("Expected the expired weather entry to be removed")
+  }
+  if _, ok := weather.entries["fresh"]; !ok {
+    t.Error("Expected the unexpired weather entry to be kept")
+  }
+
+  if removed := locations.sweep(); removed != 0 {
+    t.Errorf("Expected no location entry removed before its TTL, got %d", removed)
+  }
+  clock.advance(time.Hour)
+  if removed := locations.sweep(); removed != 1 {
+    t.Errorf("Expected 1 expired location entry removed, got %d", removed)
+  }
+  if len(locations.entries) != 0 {
+    t.Errorf("Expected an empty location cache, got %d entries", len(locations.entries))
+  }
+}
+
+// sweepCounter is a cacheSweeper that reports each sweep on a channel.
+type sweepCounter chan struct{}
+
+func (c sweepCounter) sweep() int {
+  c <- struct{}{}
+  return 0
+}
+
+func TestRunCacheJanitor(t *testing.T) {
+  sweeps := make(sweepCounter)
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan struct{})
+  go func() {
+    runCacheJanitor(ctx, time.Millisecond, sweeps)
+    close(done)
+  }()
+
+  for i := 0; i < 2; i++ {
+    select {
+    case <-sweeps:
+    case <-time.After(5 * time.Second):
+      t.Fatal("janitor did not sweep")
+    }
+  }
+
+  cancel()
+  timeout := time.After(5 * time.Second)
+  for {
+    // Keep draining: a tick may still win the race with the cancellation.
+    select {
+    case <-sweeps:
+    case <-done:
+      return
+    case <-timeout:
+      t.Fatal("janitor did not stop after the context was cancelled")
+    }
+  }
+}
+
+func TestRunCacheJanitorDisabled(t *testing.T) {
+  done := make(chan struct{})
+  go func() {
+    runCacheJanitor(context.Background(), 0, make(sweepCounter))
+    close(done)
+  }()
+
+  select {
+  case <-done:
+  case <-time.After(5 * time.Second):
+    t.Fatal("janitor with a zero interval did not return")
+  }
+}
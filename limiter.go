@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxUpstreamRequests = 100
+	defaultUpstreamAcquireWait = 100 * time.Millisecond
+)
+
+// errUpstreamBusy is returned when no outbound slot frees up in time.
+var errUpstreamBusy = errors.New("too many concurrent upstream requests")
+
+// upstreamLimiter is a semaphore bounding the outbound calls in flight
+// across every upstream provider.
+type upstreamLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// newUpstreamLimiter allows up to limit concurrent calls, each waiting at
+// most wait for a free slot. A limit of 0 disables limiting.
+func newUpstreamLimiter(limit int, wait time.Duration) *upstreamLimiter {
+	limiter := &upstreamLimiter{wait: wait}
+	if limit > 0 {
+		limiter.slots = make(chan struct{}, limit)
+	}
+	return limiter
+}
+
+// retryAfter is how long a rejected caller should wait before trying again:
+// one acquire window, the time a slot had to free up.
+func (l *upstreamLimiter) retryAfter() time.Duration {
+	return l.wait
+}
+
+// acquire takes a slot, returning the function that gives it back. It fails
+// with errUpstreamBusy after waiting l.wait, or with ctx's error if ctx ends
+// first.
+func (l *upstreamLimiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-timer.C:
+		return nil, errUpstreamBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaseOnClose holds an upstream slot until the response body it wraps is
+// closed, for responses handed to a caller that reads the body later.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
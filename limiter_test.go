@@ -0,0 +1,184 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "strconv"
+  "testing"
+  "time"
+)
+
+func TestUpstreamLimiter(t *testing.T) {
+  limiter := newUpstreamLimiter(2, 10*time.Millisecond)
+
+  first, err := limiter.acquire(context.Background())
+  if err != nil {
+    t.Fatalf("Expected first slot, got %v", err)
+  }
+  second, err := limiter.acquire(context.Background())
+  if err != nil {
+    t.Fatalf("Expected second slot, got %v", err)
+  }
+
+  if _, err := limiter.acquire(context.Background()); !errors.Is(err, errUpstreamBusy) {
+    t.Errorf("Expected errUpstreamBusy when saturated, got %v", err)
+  }
+
+  first()
+  release, err := limiter.acquire(context.Background())
+  if err != nil {
+    t.Errorf("Expected a slot after one was released, got %v", err)
+  } else {
+    release()
+  }
+  second()
+}
+
+func TestUpstreamLimiterDisabled(t *testing.T) {
+  limiter := newUpstreamLimiter(0, time.Millisecond)
+
+  for i := 0; i < 3; i++ {
+    if _, err := limiter.acquire(context.Background()); err != nil {
+      t.Fatalf("Expected no limit, got %v", err)
+    }
+  }
+}
+
+func TestTemperatureHandlerUpstreamSaturated(t *testing.T) {
+  cfg := testConfig()
+  cfg.MaxUpstreamRequests = 1
+
+  upstreamCalled := false
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    upstreamCalled = true
+    return mockResponse(http.StatusOK, mockViaCEPBody), nil
+  }))
+
+  // Hold the only slot, as a concurrent request would
+  release, err := s.upstreamSlots.acquire(context.Background())
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer release()
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusServiceUnavailable {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.Message != "serviço ocupado, tente novamente mais tarde" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "serviço ocupado, tente novamente mais tarde")
+  }
+
+  if upstreamCalled {
+    t.Error("Expected no upstream call while the limiter is saturated")
+  }
+
+  if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter != 1 {
+    t.Errorf("Expected Retry-After of 1 second, got %q", rr.Header().Get("Retry-After"))
+  }
+}
+
+func TestDoWeatherRequestHoldsSlotUntilBodyClosed(t *testing.T) {
+  cfg := testConfig()
+  cfg.MaxUpstreamRequests = 1
+  s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  resp, err := s.doWeatherRequest(context.Background(), "/current.json", url.Values{"q": {"São Paulo"}})
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  // The caller still has the body to read, so the slot is still taken
+  if _, err := s.upstreamSlots.acquire(context.Background()); !errors.Is(err, errUpstreamBusy) {
+    t.Fatalf("Expected the slot to be held until the body is closed, got %v", err)
+  }
+
+  resp.Body.Close()
+  resp.Body.Close()
+  release, err := s.upstreamSlots.acquire(context.Background())
+  if err != nil {
+    t.Fatalf("Expected the slot back once the body is closed, got %v", err)
+  }
+  release()
+}
+
+func TestResolveLocationContextErrors(t *testing.T) {
+  cancelled, cancel := context.WithCancel(context.Background())
+  cancel()
+  expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+  defer cancelExpired()
+
+  tests := []struct {
+    name     string
+    ctx      context.Context
+    status   int
+    expected string
+  }{
+    {"Cancelled", cancelled, http.StatusServiceUnavailable, msgCancelled},
+    {"Timed Out", expired, http.StatusGatewayTimeout, msgTimedOut},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := testConfig()
+      cfg.MaxUpstreamRequests = 1
+      s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+      // Hold the only slot, so the lookup waits on it until ctx is done
+      release, err := s.upstreamSlots.acquire(context.Background())
+      if err != nil {
+        t.Fatal(err)
+      }
+      defer release()
+
+      _, err = s.resolveLocation(tt.ctx, "01001000")
+      var tempErr *temperatureError
+      if !errors.As(err, &tempErr) {
+        t.Fatalf("Expected a *temperatureError, got %v", err)
+      }
+      if tempErr.Status != tt.status || tempErr.Message != tt.expected {
+        t.Errorf("Expected %d %q, got %d %q", tt.status, tt.expected, tempErr.Status, tempErr.Message)
+      }
+    })
+  }
+}
+
+func TestSetRetryAfter(t *testing.T) {
+  tests := []struct {
+    wait     time.Duration
+    expected string
+  }{
+    {10 * time.Millisecond, "1"},
+    {time.Second, "1"},
+    {1500 * time.Millisecond, "2"},
+    {30 * time.Second, "30"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.wait.String(), func(t *testing.T) {
+      rr := httptest.NewRecorder()
+      setRetryAfter(rr, tt.wait)
+
+      if got := rr.Header().Get("Retry-After"); got != tt.expected {
+        t.Errorf("setRetryAfter(%v) = %q; want %q", tt.wait, got, tt.expected)
+      }
+    })
+  }
+}
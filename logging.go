@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the incoming request IDs we reuse to short tokens
+// that are safe to echo in headers and logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// logLevel is the minimum level logger writes. main sets it from LOG_LEVEL.
+var logLevel = new(slog.LevelVar)
+
+// logger writes JSON lines to stdout. Tests may replace it to capture output.
+var logger = newLogger(os.Stdout, logLevel)
+
+// newLogger returns a JSON logger writing to w that drops records below
+// level.
+func newLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+type requestIDKey struct{}
+
+// newRequestID returns a random 128-bit hex identifier.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDFromRequest returns the caller's X-Request-ID so the request can be
+// correlated across systems, or a new ID if it is missing or malformed.
+func requestIDFromRequest(r *http.Request) string {
+	if requestID := r.Header.Get(requestIDHeader); validRequestID.MatchString(requestID) {
+		return requestID
+	}
+	return newRequestID()
+}
+
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// injectRequestID forwards the request ID carried by ctx, if any, on an
+// outbound request.
+func injectRequestID(ctx context.Context, header http.Header) {
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		header.Set(requestIDHeader, requestID)
+	}
+}
+
+// loggerFromContext returns logger annotated with the request ID carried by
+// ctx, if any.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		return logger.With("request_id", requestID)
+	}
+	return logger
+}
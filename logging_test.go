@@ -0,0 +1,144 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "log/slog"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestNewRequestID(t *testing.T) {
+  first := newRequestID()
+  second := newRequestID()
+
+  if len(first) != 32 {
+    t.Errorf("Expected a 32 character request ID, got %q", first)
+  }
+
+  if first == second {
+    t.Errorf("Expected distinct request IDs, got %q twice", first)
+  }
+}
+
+func TestTemperatureHandlerRequestID(t *testing.T) {
+  // Capture log output and restore the original logger after test
+  originalLogger := logger
+  defer func() { logger = originalLogger }()
+
+  var buf bytes.Buffer
+  logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=1234567", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  requestID := rr.Header().Get(requestIDHeader)
+  if requestID == "" {
+    t.Fatalf("Expected %s header to be set", requestIDHeader)
+  }
+
+  var entry map[string]interface{}
+  if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+    t.Fatalf("Expected a JSON log line, got %q: %v", buf.String(), err)
+  }
+
+  if entry["request_id"] != requestID {
+    t.Errorf("Expected log request_id to be %q, got %v", requestID, entry["request_id"])
+  }
+
+  if entry["cep"] != "1234567" {
+    t.Errorf("Expected log cep to be 1234567, got %v", entry["cep"])
+  }
+
+  if entry["level"] != "INFO" || entry["msg"] == "" {
+    t.Errorf("Expected level and msg fields, got %v", entry)
+  }
+}
+
+func TestTemperatureHandlerForwardsRequestID(t *testing.T) {
+  s := NewServer(testConfig(), nil)
+
+  tests := []struct {
+    name     string
+    incoming string
+    reused   bool
+  }{
+    {"Incoming ID", "req-2024.01:abc_123", true},
+    {"Missing ID", "", false},
+    {"Malformed ID", "bad id\r\ninjected", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      forwarded := map[string]string{}
+      s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        forwarded[req.URL.Host] = req.Header.Get(requestIDHeader)
+        if req.URL.Host == "viacep.com.br" {
+          return mockResponse(http.StatusOK, mockViaCEPBody), nil
+        }
+        return mockResponse(http.StatusOK, mockWeatherBody), nil
+      })
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.incoming != "" {
+        req.Header.Set(requestIDHeader, tt.incoming)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      requestID := rr.Header().Get(requestIDHeader)
+      if tt.reused && requestID != tt.incoming {
+        t.Errorf("Expected the incoming request ID %q to be kept, got %q", tt.incoming, requestID)
+      }
+      if !tt.reused && (requestID == "" || requestID == tt.incoming) {
+        t.Errorf("Expected a new request ID, got %q", requestID)
+      }
+
+      for _, host := range []string{"viacep.com.br", "api.weatherapi.com"} {
+        if forwarded[host] != requestID {
+          t.Errorf("Expected %s to receive request ID %q, got %q", host, requestID, forwarded[host])
+        }
+      }
+    })
+  }
+}
+
+func TestLoggerLevel(t *testing.T) {
+  var level slog.LevelVar
+  level.Set(slog.LevelError)
+
+  var buf bytes.Buffer
+  log := newLogger(&buf, &level)
+
+  log.Info("CEP not found", "cep", "99999999")
+  if buf.Len() != 0 {
+    t.Errorf("Expected info to be suppressed at level error, got %s", buf.String())
+  }
+
+  log.Error("weather upstream failed")
+  if !strings.Contains(buf.String(), "weather upstream failed") {
+    t.Errorf("Expected the error to be logged, got %q", buf.String())
+  }
+
+  buf.Reset()
+  level.Set(slog.LevelDebug)
+  log.Info("CEP not found", "cep", "99999999")
+  if buf.Len() == 0 {
+    t.Error("Expected info to be logged once the level is lowered")
+  }
+}
@@ -1,37 +1,150 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
-)
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+)
 
+// TemperatureResponse is encoded by its MarshalJSON and MarshalXML methods,
+// which emit only the temperature fields selected in units followed by
+// TemperatureDetails.
 type TemperatureResponse struct {
-	TempC float64 `json:"temp_C"`
-	TempF float64 `json:"temp_F"`
-	TempK float64 `json:"temp_K"`
+	TempC float64 `json:"temp_C" xml:"temp_C"`
+	TempF float64 `json:"temp_F" xml:"temp_F"`
+	TempK float64 `json:"temp_K" xml:"temp_K"`
+	TempR float64 `json:"temp_R" xml:"temp_R"`
+	TemperatureDetails
+
+	units []temperatureUnit
+	// scientific prints the text/plain values in e notation; see
+	// notationScientific.
+	scientific bool
+	// cached reports whether the weather cache served the reading; it is
+	// sent as the X-Cache header.
+	cached bool
+}
+
+// TemperatureDetails holds the non-temperature fields of a TemperatureResponse.
+// ObservedAt is the RFC 3339 time WeatherAPI last updated the reading.
+type TemperatureDetails struct {
+	City       string      `json:"city" xml:"city"`
+	ObservedAt string      `json:"observed_at,omitempty" xml:"observed_at,omitempty"`
+	Conditions *Conditions `json:"conditions,omitempty" xml:"conditions,omitempty"`
+	Location   *Address    `json:"location,omitempty" xml:"location,omitempty"`
+}
+
+// Address is the CEP's resolved address included with ?address=true.
+type Address struct {
+	Logradouro string `json:"logradouro" xml:"logradouro"`
+	Bairro     string `json:"bairro" xml:"bairro"`
+	Localidade string `json:"localidade" xml:"localidade"`
+	UF         string `json:"uf" xml:"uf"`
+}
+
+// Conditions is the extra weather data included with ?extended=true.
+type Conditions struct {
+	Humidity int     `json:"humidity" xml:"humidity"`
+	WindKph  float64 `json:"wind_kph" xml:"wind_kph"`
+	// FeelsLikeC/F/K are WeatherAPI's apparent temperature in each scale.
+	FeelsLikeC float64 `json:"feels_like_C" xml:"feels_like_C"`
+	FeelsLikeF float64 `json:"feels_like_F" xml:"feels_like_F"`
+	FeelsLikeK float64 `json:"feels_like_K" xml:"feels_like_K"`
+	// Description is WeatherAPI's condition text, localized by lang.
+	Description string `json:"description,omitempty" xml:"description,omitempty"`
+	// IconURL is the https URL of WeatherAPI's condition icon.
+	IconURL string `json:"icon_url,omitempty" xml:"icon_url,omitempty"`
+	// AirQuality is only filled in with ?aqi=true.
+	AirQuality *AirQuality `json:"air_quality,omitempty" xml:"air_quality,omitempty"`
+}
+
+// AirQuality holds WeatherAPI's particulate readings, in μg/m³.
+type AirQuality struct {
+	PM25 float64 `json:"pm2_5" xml:"pm2_5"`
+	PM10 float64 `json:"pm10" xml:"pm10"`
 }
 
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// ProblemDetails is the RFC 7807 error body sent to clients that accept
+// application/problem+json. Type is always about:blank, so Title is the
+// status text and Detail carries the same message as ErrorResponse.
+type ProblemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// ViaCEPResponse is ViaCEP's address record. The xml tags match the
+// <xmlcep> document ViaCEP serves from its XML endpoint.
 type ViaCEPResponse struct {
-	CEP         string `json:"cep"`
-	Logradouro  string `json:"logradouro"`
-	Complemento string `json:"complemento"`
-	Bairro      string `json:"bairro"`
-	Localidade  string `json:"localidade"`
-	UF          string `json:"uf"`
-	IBGE        string `json:"ibge"`
-	GIA         string `json:"gia"`
-	DDD         string `json:"ddd"`
-	SIAFI       string `json:"siafi"`
-	Erro        bool   `json:"erro"`
+	CEP         string `json:"cep" xml:"cep"`
+	Logradouro  string `json:"logradouro" xml:"logradouro"`
+	Complemento string `json:"complemento" xml:"complemento"`
+	Bairro      string `json:"bairro" xml:"bairro"`
+	Localidade  string `json:"localidade" xml:"localidade"`
+	UF          string `json:"uf" xml:"uf"`
+	IBGE        string `json:"ibge" xml:"ibge"`
+	GIA         string `json:"gia" xml:"gia"`
+	DDD         string `json:"ddd" xml:"ddd"`
+	SIAFI       string `json:"siafi" xml:"siafi"`
+	Erro        bool   `json:"erro" xml:"erro"`
+}
+
+// decodeViaCEPBody decodes a ViaCEP answer. JSON is expected, but when the
+// Content-Type says otherwise, as some proxies in front of ViaCEP cause,
+// the body is parsed as ViaCEP's XML format instead.
+func decodeViaCEPBody(contentType string, body io.Reader) (*ViaCEPResponse, error) {
+	var viaCEPResponse ViaCEPResponse
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/json" {
+		if err := json.NewDecoder(body).Decode(&viaCEPResponse); err != nil {
+			return nil, err
+		}
+		return &viaCEPResponse, nil
+	}
+
+	// Requiring the <xmlcep> root keeps an HTML error page from passing
+	// for an empty address.
+	var document struct {
+		XMLName xml.Name `xml:"xmlcep"`
+		ViaCEPResponse
+	}
+	if err := xml.NewDecoder(body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("decoding %s body as XML: %w", mediaType, err)
+	}
+	return &document.ViaCEPResponse, nil
+}
+
+type BrasilAPICEPResponse struct {
+	CEP          string `json:"cep"`
+	State        string `json:"state"`
+	City         string `json:"city"`
+	Neighborhood string `json:"neighborhood"`
+	Street       string `json:"street"`
 }
 
 type WeatherAPIResponse struct {
@@ -39,135 +152,1280 @@ type WeatherAPIResponse struct {
 		Name    string `json:"name"`
 		Region  string `json:"region"`
 		Country string `json:"country"`
+		TzID    string `json:"tz_id"`
 	} `json:"location"`
 	Current struct {
-		TempC float64 `json:"temp_c"`
+		LastUpdated string  `json:"last_updated"`
+		TempC       float64 `json:"temp_c"`
+		FeelsLikeC  float64 `json:"feelslike_c"`
+		Humidity    int     `json:"humidity"`
+		WindKph     float64 `json:"wind_kph"`
+		Condition   struct {
+			Text string `json:"text"`
+			Icon string `json:"icon"`
+		} `json:"condition"`
+		// AirQuality is only sent when the request has aqi=yes.
+		AirQuality *struct {
+			PM25 float64 `json:"pm2_5"`
+			PM10 float64 `json:"pm10"`
+		} `json:"air_quality"`
 	} `json:"current"`
 }
 
+// weatherAPITimeLayout is the layout of WeatherAPI's local timestamps, such
+// as last_updated.
+const weatherAPITimeLayout = "2006-01-02 15:04"
+
+// observedAt parses current.last_updated, a local time at the weather
+// location, into RFC 3339. The location's tz_id gives the offset; when it is
+// missing or unknown the time is taken as UTC.
+func (w *WeatherAPIResponse) observedAt() (string, error) {
+	if w.Current.LastUpdated == "" {
+		return "", nil
+	}
+
+	loc := time.UTC
+	if w.Location.TzID != "" {
+		if tz, err := time.LoadLocation(w.Location.TzID); err == nil {
+			loc = tz
+		}
+	}
+
+	observed, err := time.ParseInLocation(weatherAPITimeLayout, w.Current.LastUpdated, loc)
+	if err != nil {
+		return "", err
+	}
+	return observed.Format(time.RFC3339), nil
+}
+
+// normalizeIconURL turns WeatherAPI's protocol-relative icon paths, such as
+// "//cdn.weatherapi.com/weather/64x64/day/113.png", into https URLs.
+func normalizeIconURL(icon string) string {
+	icon = strings.TrimSpace(icon)
+	switch {
+	case icon == "":
+		return ""
+	case strings.HasPrefix(icon, "//"):
+		return "https:" + icon
+	case strings.HasPrefix(icon, "http://"):
+		return "https://" + strings.TrimPrefix(icon, "http://")
+	}
+	return icon
+}
+
+// weatherAPINoMatchingLocation is the WeatherAPI error code returned when the
+// q parameter doesn't match any known location.
+const weatherAPINoMatchingLocation = 1006
+
+type WeatherAPIErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// WeatherAPIError is returned when WeatherAPI answers with a non-200 status.
+// Code and Message come from the error body when it could be decoded.
+type WeatherAPIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *WeatherAPIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("failed to get weather data: status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("failed to get weather data: status code %d: %s (code %d)", e.StatusCode, e.Message, e.Code)
+}
+
+// newWeatherAPIError builds a WeatherAPIError from a non-200 response, reading
+// at most maxBodyBytes of it.
+func newWeatherAPIError(resp *http.Response, maxBodyBytes int64) *WeatherAPIError {
+	apiErr := &WeatherAPIError{StatusCode: resp.StatusCode}
+
+	var errorResponse WeatherAPIErrorResponse
+	if err := json.NewDecoder(limitUpstreamBody(resp.Body, maxBodyBytes)).Decode(&errorResponse); err == nil {
+		apiErr.Code = errorResponse.Error.Code
+		apiErr.Message = errorResponse.Error.Message
+	}
+
+	return apiErr
+}
+
+// Sentinel errors returned by the lookup functions. Match them with
+// errors.Is; the concrete errors carry more detail.
+var (
+	// ErrInvalidCEP is matched by the errors validateCEP returns.
+	ErrInvalidCEP = errors.New("invalid zipcode")
+	// ErrCEPNotFound means the CEP providers don't know the zipcode.
+	ErrCEPNotFound = errors.New("CEP not found")
+	// ErrCEPUnavailable is matched by ViaCEP and BrasilAPI failures:
+	// network errors, unexpected statuses and bad bodies.
+	ErrCEPUnavailable = errors.New("CEP service unavailable")
+	// ErrWeatherUnavailable is matched by WeatherAPI failures other than an
+	// unknown location: network errors, unexpected statuses and bad bodies.
+	ErrWeatherUnavailable = errors.New("weather service unavailable")
+	// ErrUFNotAllowed means the CEP resolved to a state outside ALLOWED_UFS.
+	ErrUFNotAllowed = errors.New("zipcode state not allowed")
+	// ErrUpstreamRateLimited is matched by *RateLimitedError, a provider
+	// answering 429 Too Many Requests.
+	ErrUpstreamRateLimited = errors.New("upstream rate limited")
+	// ErrInvalidUpstreamBody wraps a provider response that could not be
+	// decoded; see invalidBodyError.
+	ErrInvalidUpstreamBody = errors.New("invalid response body")
+)
+
+// invalidBodyError wraps a decode failure with ErrInvalidUpstreamBody and
+// the lookup it belonged to, such as `cep "01001000"`, so the logs say what
+// was being asked for. The decoder's error stays reachable with errors.As.
+func invalidBodyError(subject string, err error) error {
+	return fmt.Errorf("%w for %s: %w", ErrInvalidUpstreamBody, subject, err)
+}
+
+// defaultRateLimitRetryAfter is how long clients are told to wait when a
+// rate-limited provider doesn't say.
+const defaultRateLimitRetryAfter = 30 * time.Second
+
+// RateLimitedError is a 429 answer from a provider. RetryAfter comes from
+// its Retry-After header, or defaultRateLimitRetryAfter when it has none.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func newRateLimitedError(resp *http.Response) *RateLimitedError {
+	return &RateLimitedError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), defaultRateLimitRetryAfter)}
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrUpstreamRateLimited
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date,
+// returning fallback when it is missing, invalid or already past.
+func parseRetryAfter(value string, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// UpstreamError marks a failure that happened while talking to an external
+// provider (network error, unexpected status or undecodable body), as
+// opposed to an error in this service.
+type UpstreamError struct {
+	Provider string
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes WeatherAPI failures match ErrWeatherUnavailable, except for the
+// "no matching location" answer, which is the caller's problem, and CEP
+// provider failures match ErrCEPUnavailable.
+func (e *UpstreamError) Is(target error) bool {
+	switch target {
+	case ErrWeatherUnavailable:
+		if e.Provider == providerOpenWeatherMap {
+			return true
+		}
+		return e.Provider == providerWeatherAPI && !isWeatherLocationNotFound(e.Err)
+	case ErrCEPUnavailable:
+		return e.Provider == providerViaCEP || e.Provider == providerBrasilAPI
+	}
+	return false
+}
+
+const defaultMaxUpstreamBodyBytes = 1 << 20
+
+var (
+	errEmptyBody          = errors.New("empty response body")
+	errMissingTemperature = errors.New("response has no current.temp_c")
+	errBodyTooLarge       = errors.New("response body too large")
+)
+
+// limitUpstreamBody caps body at limit, UPSTREAM_MAX_BODY_BYTES. Reading past
+// the cap fails with errBodyTooLarge instead of quietly truncating, so a huge
+// body is reported as such rather than as a JSON syntax error.
+func limitUpstreamBody(body io.Reader, limit int64) io.Reader {
+	return &upstreamBodyLimiter{r: io.LimitReader(body, limit+1), remaining: limit}
+}
+
+type upstreamBodyLimiter struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *upstreamBodyLimiter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), errBodyTooLarge
+	}
+	return n, err
+}
+
+// readUpstreamBody reads a successful upstream response, failing with
+// errEmptyBody when there is nothing to decode and errBodyTooLarge when
+// there is more than limit bytes.
+func readUpstreamBody(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(limitUpstreamBody(body, limit))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errEmptyBody
+	}
+	return data, nil
+}
+
+// hasCurrentTemp reports whether a current.json body carries current.temp_c,
+// since a missing field and a real 0.0 decode to the same value.
+func hasCurrentTemp(data []byte) bool {
+	var probe struct {
+		Current *struct {
+			TempC *float64 `json:"temp_c"`
+		} `json:"current"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Current != nil && probe.Current.TempC != nil
+}
+
+// isWeatherLocationNotFound reports whether err means WeatherAPI couldn't
+// match the requested location.
+func isWeatherLocationNotFound(err error) bool {
+	var apiErr *WeatherAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == weatherAPINoMatchingLocation
+}
+
 func celsiusToFahrenheit(celsius float64) float64 {
 	return celsius*1.8 + 32
 }
 
 func celsiusToKelvin(celsius float64) float64 {
+	return celsius + 273.15
+}
+
+// legacyCelsiusToKelvin uses the 273 offset KELVIN_PRECISE=false restores.
+func legacyCelsiusToKelvin(celsius float64) float64 {
 	return celsius + 273
 }
 
+// toKelvin converts with the offset KELVIN_PRECISE picks.
+func (s *Server) toKelvin(celsius float64) float64 {
+	if !s.config.KelvinPrecise {
+		return legacyCelsiusToKelvin(celsius)
+	}
+	return celsiusToKelvin(celsius)
+}
+
+func celsiusToRankine(celsius float64) float64 {
+	return (celsius + 273.15) * 9 / 5
+}
+
+func fahrenheitToCelsius(fahrenheit float64) float64 {
+	return (fahrenheit - 32) / 1.8
+}
+
+func kelvinToCelsius(kelvin float64) float64 {
+	return kelvin - 273.15
+}
+
+// legacyKelvinToCelsius is the inverse of legacyCelsiusToKelvin.
+func legacyKelvinToCelsius(kelvin float64) float64 {
+	return kelvin - 273
+}
+
+func rankineToCelsius(rankine float64) float64 {
+	return rankine*5/9 - 273.15
+}
+
+const defaultTempDecimals = 2
+
+// roundTo rounds value to the given number of decimal places.
+func roundTo(value float64, places int) float64 {
+	if places < 0 {
+		return value
+	}
+	pow := math.Pow(10, float64(places))
+	return math.Round(value*pow) / pow
+}
+
+// invalidCEPError explains why a CEP was rejected. Its message is reported
+// to clients as is.
+type invalidCEPError struct {
+	reason string
+}
+
+func (e *invalidCEPError) Error() string {
+	return e.reason
+}
+
+func (e *invalidCEPError) Is(target error) bool {
+	return target == ErrInvalidCEP
+}
+
+var (
+	errCEPNotDigits error = &invalidCEPError{msgCEPNotDigits}
+	errCEPLength    error = &invalidCEPError{msgCEPLength}
+)
+
+var cepPattern = regexp.MustCompile(`^[0-9]{8}$`)
+
+// validateCEP explains why a normalized CEP is invalid, checking for
+// non-digit characters before the length. Only ASCII 0-9 count as digits:
+// lookalikes such as Arabic-Indic or fullwidth digits are rejected, as are
+// invalid UTF-8 bytes.
+func validateCEP(cep string) error {
+	for i := 0; i < len(cep); i++ {
+		if c := cep[i]; c < '0' || c > '9' {
+			return errCEPNotDigits
+		}
+	}
+	if !cepPattern.MatchString(cep) {
+		return errCEPLength
+	}
+	return nil
+}
+
 func isValidCEP(cep string) bool {
-	regex := regexp.MustCompile(`^\d{8}$`)
-	return regex.MatchString(cep)
+	return validateCEP(cep) == nil
+}
+
+// normalizeCEP trims surrounding whitespace and removes the hyphen of the
+// usual "12345-678" format so the result can be checked with isValidCEP.
+func normalizeCEP(cep string) string {
+	cep = strings.TrimSpace(cep)
+	if len(cep) == 9 && cep[5] == '-' {
+		cep = cep[:5] + cep[6:]
+	}
+	return cep
 }
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-var httpClient HTTPClient = &http.Client{}
+const (
+	defaultWeatherAPIBaseURL = "https://api.weatherapi.com/v1"
+	defaultViaCEPBaseURL     = "https://viacep.com.br/ws"
+)
 
-func getLocationFromCEP(cep string, client HTTPClient) (*ViaCEPResponse, error) {
-	url := fmt.Sprintf("https://viacep.com.br/ws/%s/json/", cep)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+const (
+	defaultHTTPClientTimeout   = 10 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 20
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newHTTPClient builds the outbound client from cfg. All upstream calls go to
+// a handful of hosts, so the pool keeps more idle connections per host than
+// http.DefaultTransport's two.
+func newHTTPClient(cfg Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+
+	return &http.Client{Timeout: cfg.HTTPClientTimeout, Transport: transport}
+}
+
+// prepareUpstreamRequest sets the headers every outbound call carries: the
+// trace context, the request ID and userAgent, USER_AGENT.
+func prepareUpstreamRequest(ctx context.Context, req *http.Request, userAgent string) {
+	injectTraceContext(ctx, req.Header)
+	injectRequestID(ctx, req.Header)
+	req.Header.Set("User-Agent", userAgent)
+}
+
+func (s *Server) getLocationFromCEP(ctx context.Context, cep string) (location *ViaCEPResponse, err error) {
+	ctx, span := startSpan(ctx, "viacep.lookup", attribute.String("cep", cep))
+	defer func() { endSpan(span, err) }()
+
+	endpoint := fmt.Sprintf("%s/%s/json/", s.config.ViaCEPBaseURL, cep)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	prepareUpstreamRequest(ctx, req, s.config.UserAgent)
+
+	release, err := s.upstreamSlots.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	resp, err := doUpstream(providerViaCEP, s.client, s.retryJitter, req)
+	if err != nil {
+		recordUpstreamFailure(providerViaCEP)
+		return nil, &UpstreamError{Provider: providerViaCEP, Err: err}
+	}
 	defer resp.Body.Close()
 
-	var viaCEPResponse ViaCEPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&viaCEPResponse); err != nil {
-		return nil, err
+	// ViaCEP answers unknown CEPs with 200 and {"erro": true}; any other
+	// status is an outage page, not JSON worth decoding.
+	if resp.StatusCode == http.StatusTooManyRequests {
+		recordUpstreamFailure(providerViaCEP)
+		return nil, &UpstreamError{Provider: providerViaCEP, Err: newRateLimitedError(resp)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		recordUpstreamFailure(providerViaCEP)
+		return nil, &UpstreamError{Provider: providerViaCEP, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+
+	viaCEPResponse, err := decodeViaCEPBody(resp.Header.Get("Content-Type"), limitUpstreamBody(resp.Body, s.config.MaxUpstreamBodyBytes))
+	if err != nil {
+		recordUpstreamFailure(providerViaCEP)
+		return nil, &UpstreamError{Provider: providerViaCEP, Err: invalidBodyError(fmt.Sprintf("cep %q", cep), err)}
 	}
 
 	if viaCEPResponse.Erro || viaCEPResponse.Localidade == "" {
-		return nil, fmt.Errorf("CEP not found")
+		return nil, ErrCEPNotFound
 	}
 
-	return &viaCEPResponse, nil
+	return viaCEPResponse, nil
 }
 
-func getTemperatureFromLocation(city string, client HTTPClient) (*WeatherAPIResponse, error) {
-	apiKey := os.Getenv("WEATHER_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("WEATHER_API_KEY environment variable not set")
-	}
+func (s *Server) getLocationFromBrasilAPI(ctx context.Context, cep string) (location *ViaCEPResponse, err error) {
+	ctx, span := startSpan(ctx, "brasilapi.lookup", attribute.String("cep", cep))
+	defer func() { endSpan(span, err) }()
 
-	url := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s&aqi=no", apiKey, city)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	endpoint := fmt.Sprintf("https://brasilapi.com.br/api/cep/v1/%s", cep)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
+	prepareUpstreamRequest(ctx, req, s.config.UserAgent)
 
-	resp, err := client.Do(req)
+	release, err := s.upstreamSlots.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	resp, err := doUpstream(providerBrasilAPI, s.client, s.retryJitter, req)
+	if err != nil {
+		recordUpstreamFailure(providerBrasilAPI)
+		return nil, &UpstreamError{Provider: providerBrasilAPI, Err: err}
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrCEPNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get weather data: status code %d", resp.StatusCode)
+		recordUpstreamFailure(providerBrasilAPI)
+		return nil, &UpstreamError{Provider: providerBrasilAPI, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
 	}
 
-	var weatherResponse WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weatherResponse); err != nil {
+	var brasilAPIResponse BrasilAPICEPResponse
+	if err := json.NewDecoder(limitUpstreamBody(resp.Body, s.config.MaxUpstreamBodyBytes)).Decode(&brasilAPIResponse); err != nil {
+		recordUpstreamFailure(providerBrasilAPI)
+		return nil, &UpstreamError{Provider: providerBrasilAPI, Err: invalidBodyError(fmt.Sprintf("cep %q", cep), err)}
+	}
+
+	if brasilAPIResponse.City == "" {
+		return nil, ErrCEPNotFound
+	}
+
+	return &ViaCEPResponse{
+		CEP:        brasilAPIResponse.CEP,
+		Logradouro: brasilAPIResponse.Street,
+		Bairro:     brasilAPIResponse.Neighborhood,
+		Localidade: brasilAPIResponse.City,
+		UF:         brasilAPIResponse.State,
+	}, nil
+}
+
+// getLocationWithFallback resolves the CEP with ViaCEP and, if that fails,
+// retries with BrasilAPI so a ViaCEP outage doesn't take the service down.
+func (s *Server) getLocationWithFallback(ctx context.Context, cep string) (*ViaCEPResponse, error) {
+	location, err := s.getLocationFromCEP(ctx, cep)
+	if err == nil {
+		return location, nil
+	}
+	if errors.Is(err, errUpstreamBusy) {
 		return nil, err
 	}
 
+	loggerFromContext(ctx).Warn("ViaCEP lookup failed, falling back to BrasilAPI", "cep", cep, "error", err.Error())
+	location, fallbackErr := s.getLocationFromBrasilAPI(ctx, cep)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("viacep: %w; brasilapi: %w", err, fallbackErr)
+	}
+
+	return location, nil
+}
+
+// resolveCEP returns the location for a normalized CEP from the location
+// cache, falling back to getLocationWithFallback and caching what it finds.
+// Concurrent requests for the same CEP share one lookup. When ctx carries
+// withCacheBypass the entry is refreshed instead, as the weather cache's is.
+func (s *Server) resolveCEP(ctx context.Context, cep string) (*ViaCEPResponse, error) {
+	fetch := func(ctx context.Context) (*ViaCEPResponse, error) {
+		return s.getLocationWithFallback(ctx, cep)
+	}
+	if cacheBypassed(ctx) {
+		return s.cepLocationCache.refresh(ctx, cep, fetch)
+	}
+	location, _, err := s.cepLocationCache.get(ctx, cep, fetch)
+	return location, err
+}
+
+// getTemperatureFromLocation fetches the current weather for city. lang, when
+// set, localizes the condition text; see isSupportedLang.
+func (s *Server) getTemperatureFromLocation(ctx context.Context, city, lang string) (weather *WeatherAPIResponse, err error) {
+	ctx, span := startSpan(ctx, "weatherapi.current", attribute.String("city", city))
+	defer func() { endSpan(span, err) }()
+
+	query := url.Values{}
+	query.Set("q", city)
+	query.Set("aqi", "no")
+	if airQualityRequested(ctx) {
+		query.Set("aqi", "yes")
+	}
+	if lang != "" {
+		query.Set("lang", lang)
+	}
+	applyWeatherPassthrough(ctx, query)
+
+	resp, err := s.doWeatherRequest(ctx, "/current.json", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := readUpstreamBody(resp.Body, s.config.MaxUpstreamBodyBytes)
+	if err != nil {
+		recordUpstreamFailure(providerWeatherAPI)
+		return nil, &UpstreamError{Provider: providerWeatherAPI, Err: err}
+	}
+
+	var weatherResponse WeatherAPIResponse
+	if err := json.Unmarshal(data, &weatherResponse); err != nil {
+		recordUpstreamFailure(providerWeatherAPI)
+		return nil, &UpstreamError{Provider: providerWeatherAPI, Err: invalidBodyError(fmt.Sprintf("city %q", city), err)}
+	}
+	if !hasCurrentTemp(data) {
+		recordUpstreamFailure(providerWeatherAPI)
+		return nil, &UpstreamError{Provider: providerWeatherAPI, Err: errMissingTemperature}
+	}
+
 	return &weatherResponse, nil
 }
 
-func temperatureHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+func (s *Server) temperatureHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(extractTraceContext(r), "temperatureHandler")
+	defer span.End()
+
+	requestID := requestIDFromRequest(r)
+	w.Header().Set(requestIDHeader, requestID)
+	ctx = withRequestID(ctx, requestID)
+
+	if s.serveMockTemperature(w, r.WithContext(ctx)) {
 		return
 	}
 
-	cep := r.URL.Query().Get("cep")
-	if cep == "" {
-		responseWithError(w, http.StatusBadRequest, "CEP parameter is required")
+	query := r.URL.Query()
+	cep := normalizeCEP(query.Get("cep"))
+	city := normalizeCity(query.Get("city"))
+	ibge := strings.TrimSpace(query.Get("ibge"))
+	if query.Has("city") && city == "" {
+		responseWithError(w, r, http.StatusBadRequest, msgCityBlank)
+		return
+	}
+	if countNonEmpty(cep, city, ibge) > 1 {
+		responseWithError(w, r, http.StatusBadRequest, msgLocationsExclusive)
+		return
+	}
+
+	source := query.Get("source")
+	if source != "" && source != sourceIP {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidSource)
+		return
+	}
+	byIP := source == sourceIP
+	if byIP && countNonEmpty(cep, city, ibge) > 0 {
+		responseWithError(w, r, http.StatusBadRequest, msgSourceIPCombined)
+		return
+	}
+
+	if !byIP && countNonEmpty(cep, city, ibge) == 0 {
+		responseWithError(w, r, http.StatusBadRequest, msgLocationRequired)
+		return
+	}
+
+	var ip string
+	if byIP {
+		addr, err := s.clientIP(r)
+		if err != nil {
+			loggerFromContext(ctx).Info("rejected client IP", "remote_addr", r.RemoteAddr, "error", err.Error())
+			responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidClientIP)
+			return
+		}
+		ip = addr.String()
+	}
+
+	if cep != "" {
+		if err := validateCEP(cep); err != nil {
+			loggerFromContext(ctx).Info("rejected invalid CEP", "cep", cep, "error", err.Error())
+			responseWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	if ibge != "" {
+		if err := validateIBGECode(ibge); err != nil {
+			loggerFromContext(ctx).Info("rejected invalid IBGE code", "ibge", ibge, "error", err.Error())
+			responseWithError(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	units, err := s.parseUnits(query.Get("units"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidUnits)
+		return
+	}
+
+	extended, err := parseBoolParam(query.Get("extended"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidExtended)
 		return
 	}
 
-	if !isValidCEP(cep) {
-		responseWithError(w, http.StatusUnprocessableEntity, "invalid zipcode")
+	withAddress, err := parseBoolParam(query.Get("address"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidAddress)
+		return
+	}
+
+	format := query.Get("format")
+	if format != "" && format != formatMinimal && format != formatXML {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidFormat)
+		return
+	}
+
+	notation := query.Get("notation")
+	if notation != "" && notation != notationDecimal && notation != notationScientific {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidNotation)
+		return
+	}
+
+	lang := strings.ToLower(query.Get("lang"))
+	if lang != "" && !isSupportedLang(lang) {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidLang)
+		return
+	}
+
+	if _, err := parseBoolParam(query.Get("pretty")); err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidPretty)
+		return
+	}
+
+	nocache, err := parseBoolParam(query.Get("nocache"))
+	if err != nil {
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidNoCache)
 		return
 	}
+	if nocache {
+		ctx = withCacheBypass(ctx)
+	}
 
-	location, err := getLocationFromCEP(cep, httpClient)
+	aqi, err := parseBoolParam(query.Get("aqi"))
 	if err != nil {
-		log.Printf("Error getting location from CEP: %v", err)
-		responseWithError(w, http.StatusNotFound, "can not find zipcode")
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidAQI)
 		return
 	}
+	// Air quality is only reported in conditions, so don't ask WeatherAPI
+	// for it unless they are shown.
+	if aqi && extended {
+		ctx = withAirQuality(ctx)
+	}
+
+	if params := s.passthroughParams(query); len(params) > 0 {
+		ctx = withWeatherPassthrough(ctx, params)
+	}
 
-	weather, err := getTemperatureFromLocation(location.Localidade, httpClient)
+	partial, err := parseBoolParam(query.Get("partial"))
 	if err != nil {
-		log.Printf("Error getting temperature: %v", err)
-		responseWithError(w, http.StatusInternalServerError, "failed to get temperature data")
+		responseWithError(w, r, http.StatusUnprocessableEntity, msgInvalidPartial)
 		return
 	}
 
+	var response *TemperatureResponse
+	switch {
+	case byIP:
+		response, err = s.fetchTemperatureForIP(ctx, ip, lang)
+	case city != "":
+		response, err = s.fetchTemperatureForCity(ctx, city, lang, msgCityNotFound)
+	case ibge != "":
+		response, err = s.fetchTemperatureForIBGE(ctx, ibge, lang)
+	default:
+		response, err = s.fetchTemperature(ctx, cep, lang)
+	}
+	if err != nil {
+		if partial && respondWithPartialTemperature(w, r, err) {
+			return
+		}
+		respondWithTemperatureError(w, r, err)
+		return
+	}
+	// The output flags compose independently: units picks which temp_*
+	// fields are reported and in what order, extended adds the conditions
+	// object, whose feels_like_* fields are not filtered by units, and
+	// address adds the location. XML carries the same fields as JSON. A
+	// text/plain answer honours units and notation only; format=minimal is
+	// always the bare Celsius reading.
+	response.units = units
+	response.scientific = notation == notationScientific
+	if !extended {
+		response.Conditions = nil
+	}
+	if !withAddress {
+		response.Location = nil
+	}
+
+	if byIP {
+		// The answer depends on who is asking, so shared caches must not
+		// hand it to other clients.
+		w.Header().Set("Cache-Control", privateCacheControl(s.config.CacheMaxAge))
+	} else {
+		w.Header().Set("Cache-Control", cacheControl(s.config.CacheMaxAge))
+	}
+	w.Header().Add("Vary", "Accept")
+	if response.cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Content-Location", s.canonicalTemperatureURL(r, cep))
+	// The answer is rendered up front so its ETag can be checked against
+	// If-None-Match before anything is written.
+	var body bytes.Buffer
+	contentType := "application/json"
+	switch {
+	case format == formatMinimal:
+		fmt.Fprintln(&body, formatTemperature(response.TempC))
+	case format == formatXML || prefersXML(r.Header.Get("Accept")):
+		contentType = "application/xml"
+		body.WriteString(xml.Header)
+		xml.NewEncoder(&body).Encode(response)
+		body.WriteByte('\n')
+	case prefersPlainText(r.Header.Get("Accept")):
+		contentType = "text/plain; charset=utf-8"
+		fmt.Fprintln(&body, response.text())
+	default:
+		newJSONEncoder(&body, r).Encode(response)
+	}
+
+	etag := weakETag(body.Bytes())
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// notationDecimal and notationScientific are the notation query values. The
+// text/plain answer prints fixed-point decimals unless scientific is asked
+// for, as in "2.9815e+02K"; JSON numbers are unaffected.
+const (
+	notationDecimal    = "decimal"
+	notationScientific = "scientific"
+)
+
+// formatMinimal is the format query value that answers with the bare Celsius
+// reading as a JSON number, for clients that want nothing else.
+const formatMinimal = "minimal"
+
+// formatXML is the format query value that answers in XML, like an Accept
+// header preferring application/xml; see TemperatureResponse.MarshalXML.
+const formatXML = "xml"
+
+type airQualityKey struct{}
+
+// withAirQuality marks ctx so WeatherAPI lookups ask for air quality
+// (aqi=yes). It backs ?aqi=true.
+func withAirQuality(ctx context.Context) context.Context {
+	return context.WithValue(ctx, airQualityKey{}, true)
+}
+
+func airQualityRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(airQualityKey{}).(bool)
+	return requested
+}
+
+// normalizeCity trims a city query and collapses runs of whitespace inside
+// it, so " são   paulo " is looked up as "são paulo". Case is left alone:
+// WeatherAPI ignores it and weatherCacheKey folds it.
+func normalizeCity(city string) string {
+	return strings.Join(strings.Fields(city), " ")
+}
+
+// countNonEmpty returns how many of values are set.
+func countNonEmpty(values ...string) int {
+	n := 0
+	for _, value := range values {
+		if value != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// cacheControl builds the Cache-Control value for successful temperature
+// responses, which clients and CDNs may reuse for maxAge.
+func cacheControl(maxAge time.Duration) string {
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
+
+// privateCacheControl is cacheControl for responses only the requesting
+// client may reuse.
+func privateCacheControl(maxAge time.Duration) string {
+	return fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds()))
+}
+
+// prefersXML reports whether the Accept header asks for application/xml or
+// text/xml before any other type the service can produce.
+func prefersXML(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/xml", "text/xml":
+			return true
+		case "text/plain", "application/json", "application/*", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// prefersPlainText reports whether the Accept header asks for text/plain
+// ahead of JSON. The first recognised media type wins; anything else falls
+// back to JSON.
+func prefersPlainText(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/plain":
+			return true
+		case "application/json", "application/*", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// supportedLangs lists the WeatherAPI condition languages accepted in the
+// lang query parameter. English is WeatherAPI's default and needs no code.
+var supportedLangs = map[string]bool{
+	"pt": true,
+	"es": true,
+	"fr": true,
+	"de": true,
+	"it": true,
+	"nl": true,
+	"ru": true,
+	"ja": true,
+	"zh": true,
+}
+
+func isSupportedLang(lang string) bool {
+	return supportedLangs[lang]
+}
+
+// parseBoolParam parses an optional boolean query parameter, treating an
+// empty value as false.
+func parseBoolParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// temperatureError is a lookup failure carrying the HTTP status and message
+// reported to the client.
+type temperatureError struct {
+	Status  int
+	Message string
+	Err     error
+	// RetryAfter, when positive, is sent as the Retry-After header.
+	RetryAfter time.Duration
+	// Location is set when the CEP resolved but the weather lookup failed,
+	// so ?partial=true can still report the address.
+	Location *Address
+}
+
+func (e *temperatureError) Error() string {
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *temperatureError) Unwrap() error {
+	return e.Err
+}
+
+// fetchTemperature resolves a normalized CEP to its city and current
+// temperature. Failures from it and fetchTemperatureForCity are returned as
+// *temperatureError wrapping the cause, so the sentinel errors still match.
+func (s *Server) fetchTemperature(ctx context.Context, cep, lang string) (*TemperatureResponse, error) {
+	reqLogger := loggerFromContext(ctx).With("cep", cep)
+
+	if err := validateCEP(cep); err != nil {
+		return nil, &temperatureError{Status: http.StatusUnprocessableEntity, Message: err.Error(), Err: err}
+	}
+
+	location, err := s.resolveLocation(ctx, cep)
+	if err != nil {
+		return nil, err
+	}
+
+	address := &Address{
+		Logradouro: location.Logradouro,
+		Bairro:     location.Bairro,
+		Localidade: location.Localidade,
+		UF:         location.UF,
+	}
+	response, err := s.fetchTemperatureForCity(ctx, location.Localidade, lang, msgZipcodeNotFound)
+	if isWeatherLocationNotFound(err) && location.UF != "" {
+		// WeatherAPI can't place some municipality names on their own, or
+		// places them abroad; the state and country narrow the search.
+		qualified := qualifiedCity(location)
+		reqLogger.Info("retrying weather lookup with qualified city", "city", qualified)
+		response, err = s.fetchTemperatureForCity(ctx, qualified, lang, msgZipcodeNotFound)
+		if err == nil {
+			response.City = location.Localidade
+		}
+	}
+	if err != nil {
+		var tempErr *temperatureError
+		if errors.As(err, &tempErr) {
+			tempErr.Location = address
+		}
+		return nil, err
+	}
+	response.Location = address
+	return response, nil
+}
+
+// resolveLocation resolves a validated CEP through resolveCEP and checks its
+// state against ALLOWED_UFS, mapping failures to *temperatureError.
+func (s *Server) resolveLocation(ctx context.Context, cep string) (*ViaCEPResponse, error) {
+	reqLogger := loggerFromContext(ctx).With("cep", cep)
+
+	location, err := s.resolveCEP(ctx, cep)
+	if errors.Is(err, errUpstreamBusy) {
+		reqLogger.Warn("no upstream slot available for CEP lookup")
+		return nil, &temperatureError{Status: http.StatusServiceUnavailable, Message: msgBusy, Err: err, RetryAfter: s.upstreamSlots.retryAfter()}
+	}
+	if errors.Is(err, ErrCEPNotFound) {
+		reqLogger.Info("CEP not found", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusNotFound, Message: msgZipcodeNotFound, Err: err}
+	}
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) {
+		reqLogger.Warn("CEP upstream rate limited", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusServiceUnavailable, Message: msgZipcodeRateLimited, Err: err, RetryAfter: rateLimited.RetryAfter}
+	}
+	if errors.Is(err, ErrCEPUnavailable) {
+		reqLogger.Error("CEP upstream failed", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusBadGateway, Message: msgZipcodeFailed, Err: err}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		reqLogger.Warn("CEP lookup timed out", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusGatewayTimeout, Message: msgTimedOut, Err: err}
+	}
+	if errors.Is(err, context.Canceled) {
+		reqLogger.Info("CEP lookup cancelled", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusServiceUnavailable, Message: msgCancelled, Err: err}
+	}
+	if err != nil {
+		reqLogger.Error("failed to get location from CEP", "error", err.Error())
+		return nil, &temperatureError{Status: http.StatusNotFound, Message: msgZipcodeNotFound, Err: err}
+	}
+	if !s.config.ufAllowed(location.UF) {
+		reqLogger.Info("CEP outside the allowed states", "uf", location.UF)
+		return nil, &temperatureError{Status: http.StatusForbidden, Message: msgStateNotAllowed, Err: ErrUFNotAllowed}
+	}
+	return location, nil
+}
+
+// qualifiedCity names location's city the way WeatherAPI disambiguates it,
+// as in "Bom Jesus, PI, Brazil".
+func qualifiedCity(location *ViaCEPResponse) string {
+	return location.Localidade + ", " + location.UF + ", Brazil"
+}
+
+// fetchTemperatureForCity fetches the current temperature for city, with the
+// condition text in lang. notFoundMessage is reported when WeatherAPI can't
+// match the city.
+func (s *Server) fetchTemperatureForCity(ctx context.Context, city, lang, notFoundMessage string) (*TemperatureResponse, error) {
+	response, err := s.lookupWeather(ctx, city, lang, notFoundMessage)
+	if err != nil {
+		return nil, err
+	}
+	response.City = city
+	return response, nil
+}
+
+// lookupWeather asks s's weather providers in turn for the temperature at q
+// (a city name, IP address or coordinate pair), moving on while they are
+// unavailable, and maps WeatherAPI's failure to *temperatureError. The
+// response is reported under the place the provider matched, or q when it
+// doesn't say.
+func (s *Server) lookupWeather(ctx context.Context, q, lang, notFoundMessage string) (*TemperatureResponse, error) {
+	reqLogger := loggerFromContext(ctx).With("city", q)
+
+	var errs []error
+	for _, provider := range s.weatherProviders {
+		response, err := s.currentTemperature(ctx, provider, q, lang)
+		if err == nil {
+			if len(errs) > 0 {
+				reqLogger.Warn("WeatherAPI failed, answered by a secondary provider", "error", errs[0].Error())
+			}
+			return response, nil
+		}
+		errs = append(errs, err)
+		// Only an unavailable provider is worth replacing; the next one
+		// would fail the same way for an unknown location or a canceled
+		// request.
+		if !errors.Is(err, ErrWeatherUnavailable) && !errors.Is(err, errCircuitOpen) {
+			break
+		}
+	}
+	if len(errs) > 1 {
+		reqLogger.Warn("secondary weather providers failed", "error", errors.Join(errs[1:]...).Error())
+	}
+	return nil, s.weatherError(reqLogger, errs[0], notFoundMessage, msgTemperatureFailed)
+}
+
+// currentTemperature asks provider for the temperature at q. Providers that
+// report full readings fill in the conditions and the cache status; the
+// others only give the temperature, so conditions are left out.
+func (s *Server) currentTemperature(ctx context.Context, provider WeatherProvider, q, lang string) (*TemperatureResponse, error) {
+	if reporter, ok := provider.(weatherReporter); ok {
+		weather, cached, err := reporter.currentWeather(ctx, q, lang)
+		if err != nil {
+			return nil, err
+		}
+		response := s.newTemperatureResponse(ctx, weather, weather.Location.Name)
+		response.cached = cached
+		return response, nil
+	}
+
+	tempC, err := provider.CurrentTempC(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var weather WeatherAPIResponse
+	weather.Current.TempC = tempC
+	response := s.newTemperatureResponse(ctx, &weather, q)
+	response.Conditions = nil
+	return response, nil
+}
+
+// weatherError maps a failed WeatherAPI lookup to *temperatureError, logging
+// it to reqLogger. notFoundMessage is reported when WeatherAPI can't match
+// the location and failureMessage when the lookup fails otherwise.
+func (s *Server) weatherError(reqLogger *slog.Logger, err error, notFoundMessage, failureMessage string) error {
+	if isWeatherLocationNotFound(err) {
+		reqLogger.Info("weather location not found", "error", err.Error())
+		return &temperatureError{Status: http.StatusNotFound, Message: notFoundMessage, Err: err}
+	}
+	if errors.Is(err, errCircuitOpen) {
+		reqLogger.Warn("weather circuit breaker open, skipping upstream call")
+		return &temperatureError{Status: http.StatusServiceUnavailable, Message: msgWeatherUnavailable, Err: err, RetryAfter: s.weatherBreaker.retryAfter()}
+	}
+	if errors.Is(err, errUpstreamBusy) {
+		reqLogger.Warn("no upstream slot available for weather lookup")
+		return &temperatureError{Status: http.StatusServiceUnavailable, Message: msgBusy, Err: err, RetryAfter: s.upstreamSlots.retryAfter()}
+	}
+	if errors.Is(err, ErrWeatherUnavailable) {
+		reqLogger.Error("weather upstream failed", "error", err.Error())
+		return &temperatureError{Status: http.StatusBadGateway, Message: failureMessage, Err: err}
+	}
+	if errors.Is(err, errMissingWeatherAPIKey) {
+		reqLogger.Error("no WeatherAPI key configured", "error", err.Error())
+		return &temperatureError{Status: http.StatusServiceUnavailable, Message: msgMisconfigured, Err: err}
+	}
+	reqLogger.Error("failed to get weather", "error", err.Error())
+	return &temperatureError{Status: http.StatusInternalServerError, Message: failureMessage, Err: err}
+}
+
+// newTemperatureResponse converts a WeatherAPI reading into the response
+// reported for city.
+func (s *Server) newTemperatureResponse(ctx context.Context, weather *WeatherAPIResponse, city string) *TemperatureResponse {
+	observedAt, err := weather.observedAt()
+	if err != nil {
+		loggerFromContext(ctx).Warn("invalid last_updated from WeatherAPI", "last_updated", weather.Current.LastUpdated, "error", err.Error())
+	}
+
+	decimals := s.config.TempDecimals
 	tempC := weather.Current.TempC
-	tempF := celsiusToFahrenheit(tempC)
-	tempK := celsiusToKelvin(tempC)
+	tempF := roundTo(celsiusToFahrenheit(tempC), decimals)
+	tempK := roundTo(s.toKelvin(tempC), decimals)
+	tempR := roundTo(celsiusToRankine(tempC), decimals)
+	tempC = roundTo(tempC, decimals)
+	feelsLikeC := weather.Current.FeelsLikeC
 
-	response := TemperatureResponse{
+	response := &TemperatureResponse{
 		TempC: tempC,
 		TempF: tempF,
 		TempK: tempK,
+		TempR: tempR,
+		TemperatureDetails: TemperatureDetails{
+			City:       city,
+			ObservedAt: observedAt,
+			Conditions: &Conditions{
+				Humidity:    weather.Current.Humidity,
+				WindKph:     weather.Current.WindKph,
+				FeelsLikeC:  roundTo(feelsLikeC, decimals),
+				FeelsLikeF:  roundTo(celsiusToFahrenheit(feelsLikeC), decimals),
+				FeelsLikeK:  roundTo(s.toKelvin(feelsLikeC), decimals),
+				Description: weather.Current.Condition.Text,
+				IconURL:     normalizeIconURL(weather.Current.Condition.Icon),
+			},
+		},
 	}
+	if aq := weather.Current.AirQuality; aq != nil {
+		response.Conditions.AirQuality = &AirQuality{PM25: aq.PM25, PM10: aq.PM10}
+	}
+	return response
+}
+
+func respondWithTemperatureError(w http.ResponseWriter, r *http.Request, err error) {
+	var tempErr *temperatureError
+	if errors.As(err, &tempErr) {
+		if tempErr.RetryAfter > 0 {
+			setRetryAfter(w, tempErr.RetryAfter)
+		}
+		responseWithError(w, r, tempErr.Status, tempErr.Message)
+		return
+	}
+	responseWithError(w, r, http.StatusInternalServerError, msgTemperatureFailed)
+}
 
+// PartialTemperatureResponse is sent with ?partial=true when the CEP
+// resolved but the weather lookup failed: the temperatures are null and
+// WeatherError carries the message /temperature would have returned.
+type PartialTemperatureResponse struct {
+	TempC        *float64 `json:"temp_C"`
+	TempF        *float64 `json:"temp_F"`
+	TempK        *float64 `json:"temp_K"`
+	TempR        *float64 `json:"temp_R"`
+	City         string   `json:"city"`
+	Location     *Address `json:"location"`
+	WeatherError string   `json:"weather_error"`
+}
+
+// respondWithPartialTemperature writes a PartialTemperatureResponse when err
+// is a weather failure for a resolved CEP, reporting whether it did. The
+// answer is degraded, so it is never cached. WeatherError is translated like
+// responseWithError's messages.
+func respondWithPartialTemperature(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tempErr *temperatureError
+	if !errors.As(err, &tempErr) || tempErr.Location == nil {
+		return false
+	}
+
+	lang := errorLanguageFromRequest(r)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	newJSONEncoder(w, r).Encode(PartialTemperatureResponse{
+		City:         tempErr.Location.Localidade,
+		Location:     tempErr.Location,
+		WeatherError: translateError(lang, tempErr.Message),
+	})
+	return true
 }
 
-func responseWithError(w http.ResponseWriter, statusCode int, message string) {
+// setRetryAfter tells the client how many seconds to wait before retrying,
+// rounded up so it doesn't come back before d has passed.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// responseWithError writes a JSON error, as RFC 7807 problem details when the
+// client accepts application/problem+json. The message is translated into
+// the language picked from Accept-Language; see errorLanguage. Errors are
+// never cacheable.
+func responseWithError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	lang := errorLanguageFromRequest(r)
+	message = translateError(lang, message)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	if acceptsProblemJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(statusCode)
+		newJSONEncoder(w, r).Encode(ProblemDetails{
+			Type:   "about:blank",
+			Title:  http.StatusText(statusCode),
+			Status: statusCode,
+			Detail: message,
+		})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
+	newJSONEncoder(w, r).Encode(ErrorResponse{Message: message})
+}
+
+// newJSONEncoder returns an encoder for w that indents its output with two
+// spaces when r asks for ?pretty=true, for people reading responses in a
+// terminal. Output is compact otherwise, including when pretty is invalid.
+func newJSONEncoder(w io.Writer, r *http.Request) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	if pretty, _ := parseBoolParam(r.URL.Query().Get("pretty")); pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
+
+// acceptsProblemJSON reports whether the Accept header lists
+// application/problem+json. Errors keep the legacy shape otherwise.
+func acceptsProblemJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == "application/problem+json" {
+			return true
+		}
+	}
+	return false
 }
 
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -176,16 +1434,45 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	check := flag.Bool("check", false, "validate the configuration and exit without starting the server")
+	flag.Parse()
+
+	if *check || boolFromEnv("CHECK_CONFIG", false) {
+		os.Exit(checkConfig(os.Stdout, os.Stderr))
 	}
 
-	http.HandleFunc("/temperature", temperatureHandler)
-	http.HandleFunc("/health", healthCheckHandler)
+	cfg, err := LoadConfig()
+	if err != nil {
+		logger.Error("invalid configuration", "error", err.Error())
+		os.Exit(1)
+	}
+	logLevel.Set(cfg.LogLevel)
+
+	app := NewServer(cfg, newHTTPClient(cfg))
+	server := &http.Server{
+		Addr:    cfg.listenAddr(),
+		Handler: app.routes(),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	go runCacheJanitor(ctx, cfg.CacheSweepInterval, app.cityWeatherCache, app.cepLocationCache)
+
+	if cfg.PreloadCEPsFile != "" {
+		app.startPreload(ctx, cfg.PreloadCEPsFile)
+	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	logger.Info("server starting", "addr", server.Addr)
+	if err := serve(ctx, server, cfg.ShutdownTimeout); err != nil {
+		logger.Error("server failed", "error", err.Error())
+		os.Exit(1)
 	}
 }
@@ -1,12 +1,20 @@
 package main
 
 import (
+  "context"
   "encoding/json"
+  "encoding/xml"
+  "errors"
   "io"
+  "math"
   "net/http"
   "net/http/httptest"
+  "net/url"
+  "reflect"
+  "strconv"
   "strings"
   "testing"
+  "time"
 )
 
 func TestCelsiusToFahrenheit(t *testing.T) {
@@ -31,6 +39,31 @@ func TestCelsiusToFahrenheit(t *testing.T) {
 }
 
 func TestCelsiusToKelvin(t *testing.T) {
+  tests := []struct {
+    name     string
+    celsius  float64
+    expected float64
+  }{
+    {"Zero", 0, 273.15},
+    {"Positive", 25, 298.15},
+    {"Negative", -10, 263.15},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      result := celsiusToKelvin(tt.celsius)
+      if result != tt.expected {
+        t.Errorf("celsiusToKelvin(%f) = %f; want %f", tt.celsius, result, tt.expected)
+      }
+    })
+  }
+}
+
+func TestCelsiusToKelvinLegacy(t *testing.T) {
+  cfg := testConfig()
+  cfg.KelvinPrecise = false
+  s := NewServer(cfg, nil)
+
   tests := []struct {
     name     string
     celsius  float64
@@ -43,9 +76,60 @@ func TestCelsiusToKelvin(t *testing.T) {
 
   for _, tt := range tests {
     t.Run(tt.name, func(t *testing.T) {
-      result := celsiusToKelvin(tt.celsius)
+      result := s.toKelvin(tt.celsius)
       if result != tt.expected {
-        t.Errorf("celsiusToKelvin(%f) = %f; want %f", tt.celsius, result, tt.expected)
+        t.Errorf("toKelvin(%f) = %f; want %f", tt.celsius, result, tt.expected)
+      }
+    })
+  }
+}
+
+func TestCelsiusToRankine(t *testing.T) {
+  tests := []struct {
+    name     string
+    celsius  float64
+    expected float64
+  }{
+    {"Zero", 0, 491.67},
+    {"Positive", 25, 536.67},
+    {"Negative", -10, 473.67},
+    {"Absolute Zero", -273.15, 0},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      result := celsiusToRankine(tt.celsius)
+      if math.Abs(result-tt.expected) > 1e-9 {
+        t.Errorf("celsiusToRankine(%f) = %f; want %f", tt.celsius, result, tt.expected)
+      }
+    })
+  }
+
+  if result := celsiusToRankine(-273.15); result != 0 {
+    t.Errorf("celsiusToRankine(-273.15) = %v; want exactly 0", result)
+  }
+}
+
+func TestRoundTo(t *testing.T) {
+  tests := []struct {
+    name     string
+    value    float64
+    places   int
+    expected float64
+  }{
+    {"Float Noise", 77.54000000000001, 2, 77.54},
+    {"Round Up", 298.456, 2, 298.46},
+    {"Negative", -3.456, 2, -3.46},
+    {"Negative Round Toward Zero", -12.341, 1, -12.3},
+    {"Zero Places", 25.6, 0, 26},
+    {"Negative Places", 25.123, -1, 25.123},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      result := roundTo(tt.value, tt.places)
+      if result != tt.expected {
+        t.Errorf("roundTo(%v, %d) = %v; want %v", tt.value, tt.places, result, tt.expected)
       }
     })
   }
@@ -63,6 +147,9 @@ func TestIsValidCEP(t *testing.T) {
     {"Invalid CEP - Too Long", "123456789", false},
     {"Invalid CEP - Empty", "", false},
     {"Invalid CEP - With Hyphen", "12345-678", false},
+    {"Invalid CEP - Arabic-Indic Digits", "٠١٠٠١٠٠٠", false},
+    {"Invalid CEP - Fullwidth Digits", "０１００１０００", false},
+    {"Invalid CEP - Invalid UTF-8", "0100100\xff", false},
   }
 
   for _, tt := range tests {
@@ -75,6 +162,225 @@ func TestIsValidCEP(t *testing.T) {
   }
 }
 
+func TestValidateCEP(t *testing.T) {
+  tests := []struct {
+    name     string
+    cep      string
+    expected error
+  }{
+    {"Valid CEP", "12345678", nil},
+    {"Letters", "1234567a", errCEPNotDigits},
+    {"Letters And Too Short", "12ab", errCEPNotDigits},
+    {"With Hyphen", "12345-678", errCEPNotDigits},
+    {"Unicode Digits", "١٢٣", errCEPNotDigits},
+    {"Too Short", "1234567", errCEPLength},
+    {"Too Long", "123456789", errCEPLength},
+    {"Empty", "", errCEPLength},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      err := validateCEP(tt.cep)
+      if err != tt.expected {
+        t.Errorf("validateCEP(%q) = %v; want %v", tt.cep, err, tt.expected)
+      }
+      if invalid := errors.Is(err, ErrInvalidCEP); invalid != (tt.expected != nil) {
+        t.Errorf("errors.Is(validateCEP(%q), ErrInvalidCEP) = %v", tt.cep, invalid)
+      }
+    })
+  }
+}
+
+func FuzzNormalizeCEP(f *testing.F) {
+  for _, seed := range []string{"01001000", "01001-000", " 01001-000 ", "1-2", "١٢٣٤٥-٦٧٨", "０１００１０００", "0100100\xff", ""} {
+    f.Add(seed)
+  }
+
+  f.Fuzz(func(t *testing.T, input string) {
+    cep := normalizeCEP(input)
+    if !isValidCEP(cep) {
+      return
+    }
+    if len(cep) != 8 {
+      t.Fatalf("normalizeCEP(%q) = %q was accepted with %d bytes", input, cep, len(cep))
+    }
+    for i := 0; i < len(cep); i++ {
+      if cep[i] < '0' || cep[i] > '9' {
+        t.Fatalf("normalizeCEP(%q) = %q was accepted with a non-ASCII-digit byte", input, cep)
+      }
+    }
+  })
+}
+
+func TestLookupSentinelErrors(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  notFound := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if strings.Contains(req.URL.String(), "brasilapi.com.br") {
+      return mockResponse(http.StatusNotFound, `{"message": "CEP não encontrado"}`), nil
+    }
+    return mockResponse(http.StatusOK, `{"erro": true}`), nil
+  })
+  unreachable := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return nil, errors.New("connection refused")
+  })
+  weatherDown := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusInternalServerError, `{}`), nil
+  })
+  weatherUnknown := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+  })
+
+  ctx := context.Background()
+  tests := []struct {
+    name     string
+    lookup   func() error
+    expected error
+  }{
+    {"ViaCEP Not Found", func() error {
+      _, err := NewServer(testConfig(), notFound).getLocationFromCEP(ctx, "99999999")
+      return err
+    }, ErrCEPNotFound},
+    {"BrasilAPI Not Found", func() error {
+      _, err := NewServer(testConfig(), notFound).getLocationFromBrasilAPI(ctx, "99999999")
+      return err
+    }, ErrCEPNotFound},
+    {"Both Providers Not Found", func() error {
+      _, err := NewServer(testConfig(), notFound).getLocationWithFallback(ctx, "99999999")
+      return err
+    }, ErrCEPNotFound},
+    {"Weather Unreachable", func() error {
+      _, err := NewServer(testConfig(), unreachable).getTemperatureFromLocation(ctx, "São Paulo", "")
+      return err
+    }, ErrWeatherUnavailable},
+    {"Weather Server Error", func() error {
+      _, err := NewServer(testConfig(), weatherDown).getTemperatureFromLocation(ctx, "São Paulo", "")
+      return err
+    }, ErrWeatherUnavailable},
+    {"Forecast Server Error", func() error {
+      _, err := NewServer(testConfig(), weatherDown).getForecastFromLocation(ctx, "São Paulo", 3)
+      return err
+    }, ErrWeatherUnavailable},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if err := tt.lookup(); !errors.Is(err, tt.expected) {
+        t.Errorf("Expected %v, got %v", tt.expected, err)
+      }
+    })
+  }
+
+  _, err := NewServer(testConfig(), weatherUnknown).getTemperatureFromLocation(ctx, "Atlantis", "")
+  if err == nil || errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected an unknown location not to match ErrWeatherUnavailable, got %v", err)
+  }
+}
+
+func TestFetchTemperatureSentinelErrors(t *testing.T) {
+  s := NewServer(testConfig(), nil)
+
+  tests := []struct {
+    name           string
+    cep            string
+    client         HTTPClient
+    expected       error
+    expectedStatus int
+  }{
+    {"Invalid CEP", "1234567", mockUpstreamClient(mockViaCEPBody, mockWeatherBody), ErrInvalidCEP, http.StatusUnprocessableEntity},
+    {"CEP Not Found", "99999999", mockUpstreamClient(`{"erro": true}`, mockWeatherBody), ErrCEPNotFound, http.StatusNotFound},
+    {"Weather Unavailable", "01001000", setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+      if strings.Contains(req.URL.String(), "viacep.com.br") {
+        return mockResponse(http.StatusOK, mockViaCEPBody), nil
+      }
+      return mockResponse(http.StatusForbidden, `{"error":{"code":2008,"message":"API key has been disabled."}}`), nil
+    }), ErrWeatherUnavailable, http.StatusBadGateway},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      s.client = tt.client
+
+      _, err := s.fetchTemperature(context.Background(), tt.cep, "")
+      if !errors.Is(err, tt.expected) {
+        t.Fatalf("Expected %v, got %v", tt.expected, err)
+      }
+
+      var tempErr *temperatureError
+      if !errors.As(err, &tempErr) || tempErr.Status != tt.expectedStatus {
+        t.Errorf("Expected status %d, got %v", tt.expectedStatus, err)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerInvalidCEPMessages(t *testing.T) {
+  tests := []struct {
+    cep             string
+    expectedMessage string
+  }{
+    {"1234567", "o CEP deve ter 8 dígitos"},
+    {"123456789", "o CEP deve ter 8 dígitos"},
+    {"1234567a", "o CEP deve conter apenas dígitos"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.cep, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep="+tt.cep, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusUnprocessableEntity {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
+
+func TestNormalizeCEP(t *testing.T) {
+  tests := []struct {
+    name     string
+    cep      string
+    expected string
+    valid    bool
+  }{
+    {"With Hyphen", "01001-000", "01001000", true},
+    {"Digits Only", "01001000", "01001000", true},
+    {"Surrounding Whitespace", " 01001000 ", "01001000", true},
+    {"Hyphen And Whitespace", " 01001-000 ", "01001000", true},
+    {"Invalid Short", "1-2", "1-2", false},
+    {"Invalid Misplaced Hyphen", "123-456", "123-456", false},
+    {"Invalid Letters", "abcd-efgh", "abcd-efgh", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      result := normalizeCEP(tt.cep)
+      if result != tt.expected {
+        t.Errorf("normalizeCEP(%q) = %q; want %q", tt.cep, result, tt.expected)
+      }
+      if valid := isValidCEP(result); valid != tt.valid {
+        t.Errorf("isValidCEP(normalizeCEP(%q)) = %v; want %v", tt.cep, valid, tt.valid)
+      }
+    })
+  }
+}
+
 // Mock HTTP client for testing
 type MockHTTPClient struct {
   DoFunc func(req *http.Request) (*http.Response, error)
@@ -101,6 +407,75 @@ func mockResponse(statusCode int, body string) *http.Response {
   }
 }
 
+// roundTripFunc lets tests plug a function in as an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+  return f(req)
+}
+
+func TestHTTPClientTimeoutCancelsRequest(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  cfg := defaultConfig()
+  cfg.HTTPClientTimeout = 50 * time.Millisecond
+  client := newHTTPClient(cfg)
+  client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+    // Simulate a hung upstream that only gives up when the request is cancelled
+    select {
+    case <-time.After(5 * time.Second):
+      return mockResponse(http.StatusOK, "{}"), nil
+    case <-req.Context().Done():
+      return nil, req.Context().Err()
+    }
+  })
+
+  start := time.Now()
+  _, err := NewServer(testConfig(), client).getLocationFromCEP(context.Background(), "01001000")
+  if err == nil {
+    t.Fatal("Expected timeout error, got nil")
+  }
+
+  if elapsed := time.Since(start); elapsed > time.Second {
+    t.Errorf("Expected request to be cancelled after the client timeout, took %v", elapsed)
+  }
+}
+
+// Helper function returning the default config with a test API key
+func testConfig() Config {
+  cfg := defaultConfig()
+  cfg.WeatherAPIKeys = []string{"test-api-key"}
+  // Handler tests mock different WeatherAPI answers for the same city, so
+  // they must not be served cached responses.
+  cfg.WeatherCacheTTL = 0
+  cfg.LocationCacheTTL = 0
+  return cfg
+}
+
+// Helper function to build a server sending the given WeatherAPI keys
+func serverWithKeys(keys []string, client HTTPClient) *Server {
+  cfg := testConfig()
+  cfg.WeatherAPIKeys = keys
+  return NewServer(cfg, client)
+}
+
+// Helper function to create a mock client answering both ViaCEP and WeatherAPI
+func mockUpstreamClient(viaCEPBody, weatherBody string) *MockHTTPClient {
+  return setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if strings.Contains(req.URL.String(), "viacep.com.br") {
+      return mockResponse(http.StatusOK, viaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, weatherBody), nil
+  })
+}
+
+const (
+  mockViaCEPBody  = `{"cep": "01001-000", "localidade": "São Paulo", "uf": "SP"}`
+  mockWeatherBody = `{"location": {"name": "São Paulo"}, "current": {"temp_c": 25.0}}`
+)
+
 func TestGetLocationFromCEP(t *testing.T) {
   // Test case 1: Valid CEP
   mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
@@ -118,8 +493,9 @@ func TestGetLocationFromCEP(t *testing.T) {
     }`
     return mockResponse(http.StatusOK, validResponse), nil
   })
+  s := NewServer(testConfig(), mockClient)
 
-  location, err := getLocationFromCEP("01001000", mockClient)
+  location, err := s.getLocationFromCEP(context.Background(), "01001000")
   if err != nil {
     t.Errorf("Expected no error, got %v", err)
   }
@@ -134,247 +510,2043 @@ func TestGetLocationFromCEP(t *testing.T) {
   }
 
   // Test case 3: CEP not found
-  mockClient = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+  s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
     notFoundResponse := `{"erro": true}`
     return mockResponse(http.StatusOK, notFoundResponse), nil
   })
 
-  _, err = getLocationFromCEP("99999999", mockClient)
+  _, err = s.getLocationFromCEP(context.Background(), "99999999")
   if err == nil {
     t.Errorf("Expected error for CEP not found, got nil")
   }
 }
 
-func TestGetTemperatureFromLocation(t *testing.T) {
-  // Set environment variable for testing
-  t.Setenv("WEATHER_API_KEY", "test-api-key")
+func TestGetLocationWithFallback(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
 
-  // Test case 1: Valid location
+  // ViaCEP is down, BrasilAPI answers
   mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
-    validResponse := `{
-      "location": {
-        "name": "São Paulo",
-        "region": "Sao Paulo",
-        "country": "Brazil"
-      },
-      "current": {
-        "temp_c": 25.0
-      }
+    if strings.Contains(req.URL.String(), "viacep.com.br") {
+      return nil, errors.New("connection refused")
+    }
+    brasilAPIResponse := `{
+      "cep": "01001000",
+      "state": "SP",
+      "city": "São Paulo",
+      "neighborhood": "Sé",
+      "street": "Praça da Sé"
     }`
-    return mockResponse(http.StatusOK, validResponse), nil
+    return mockResponse(http.StatusOK, brasilAPIResponse), nil
   })
+  s := NewServer(testConfig(), mockClient)
 
-  weather, err := getTemperatureFromLocation("São Paulo", mockClient)
+  location, err := s.getLocationWithFallback(context.Background(), "01001000")
   if err != nil {
-    t.Errorf("Expected no error, got %v", err)
+    t.Fatalf("Expected no error, got %v", err)
   }
 
-  if weather.Current.TempC != 25.0 {
-    t.Errorf("Expected temperature to be 25.0, got %f", weather.Current.TempC)
+  if location.Localidade != "São Paulo" || location.UF != "SP" || location.Bairro != "Sé" {
+    t.Errorf("Expected BrasilAPI fields to be mapped, got %+v", location)
   }
 
-  // Test case 2: API error
-  mockClient = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
-    return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+  // Both providers fail
+  s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if strings.Contains(req.URL.String(), "viacep.com.br") {
+      return nil, errors.New("connection refused")
+    }
+    return mockResponse(http.StatusNotFound, `{"message": "CEP não encontrado"}`), nil
   })
 
-  _, err = getTemperatureFromLocation("NonExistentCity", mockClient)
+  _, err = s.getLocationWithFallback(context.Background(), "99999999")
   if err == nil {
-    t.Errorf("Expected error for invalid location, got nil")
+    t.Errorf("Expected error when both providers fail, got nil")
   }
 }
 
-func TestTemperatureHandlerInvalidCEP(t *testing.T) {
-  // Create a request with an invalid CEP
-  req, err := http.NewRequest("GET", "/temperature?cep=1234567", nil)
-  if err != nil {
-    t.Fatal(err)
+func TestGetLocationFromCEPXML(t *testing.T) {
+  jsonBody := `{
+    "cep": "01001-000",
+    "logradouro": "Praça da Sé",
+    "complemento": "lado ímpar",
+    "bairro": "Sé",
+    "localidade": "São Paulo",
+    "uf": "SP",
+    "ibge": "3550308",
+    "gia": "1004",
+    "ddd": "11",
+    "siafi": "7107"
+  }`
+  xmlBody := `<?xml version="1.0" encoding="UTF-8"?>
+<xmlcep>
+  <cep>01001-000</cep>
+  <logradouro>Praça da Sé</logradouro>
+  <complemento>lado ímpar</complemento>
+  <bairro>Sé</bairro>
+  <localidade>São Paulo</localidade>
+  <uf>SP</uf>
+  <ibge>3550308</ibge>
+  <gia>1004</gia>
+  <ddd>11</ddd>
+  <siafi>7107</siafi>
+</xmlcep>`
+
+  lookup := func(contentType, body string) (*ViaCEPResponse, error) {
+    mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+      resp := mockResponse(http.StatusOK, body)
+      resp.Header.Set("Content-Type", contentType)
+      return resp, nil
+    })
+    return NewServer(testConfig(), mockClient).getLocationFromCEP(context.Background(), "01001000")
   }
 
-  // Create a ResponseRecorder to record the response
-  rr := httptest.NewRecorder()
-  handler := http.HandlerFunc(temperatureHandler)
+  fromJSON, err := lookup("application/json; charset=utf-8", jsonBody)
+  if err != nil {
+    t.Fatalf("Expected no error for the JSON body, got %v", err)
+  }
 
-  // Call the handler
-  handler.ServeHTTP(rr, req)
+  fromXML, err := lookup("application/xml; charset=utf-8", xmlBody)
+  if err != nil {
+    t.Fatalf("Expected no error for the XML body, got %v", err)
+  }
 
-  // Check the status code
-  if status := rr.Code; status != http.StatusUnprocessableEntity {
-    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  if !reflect.DeepEqual(fromXML, fromJSON) {
+    t.Errorf("Expected XML to parse like JSON:\n got %+v\nwant %+v", fromXML, fromJSON)
   }
 
-  // Check the response body
-  var response ErrorResponse
-  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-    t.Errorf("Failed to parse response body: %v", err)
+  _, err = lookup("text/xml", `<xmlcep><erro>true</erro></xmlcep>`)
+  if !errors.Is(err, ErrCEPNotFound) {
+    t.Errorf("Expected ErrCEPNotFound for an XML erro document, got %v", err)
   }
 
-  expectedMessage := "invalid zipcode"
-  if response.Message != expectedMessage {
-    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  _, err = lookup("text/html", `<html><body>Bad Gateway</body></html>`)
+  if !errors.Is(err, ErrCEPUnavailable) {
+    t.Errorf("Expected ErrCEPUnavailable for an unparseable body, got %v", err)
   }
 }
 
-func TestTemperatureHandlerSuccess(t *testing.T) {
-  // Save original HTTP client and restore it after test
-  originalClient := httpClient
-  defer func() { httpClient = originalClient }()
-
-  // Set environment variable for testing
-  t.Setenv("WEATHER_API_KEY", "test-api-key")
+func TestGetLocationFromCEPServerError(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
 
-  // Create a mock client that handles both API calls
-  mockClient := &MockHTTPClient{
-    DoFunc: func(req *http.Request) (*http.Response, error) {
-      // Check which API is being called based on the URL
-      if strings.Contains(req.URL.String(), "viacep.com.br") {
-        // Mock ViaCEP response
-        viaCEPResponse := `{
-          "cep": "01001000",
-          "logradouro": "Praça da Sé",
-          "complemento": "lado ímpar",
-          "bairro": "Sé",
-          "localidade": "São Paulo",
-          "uf": "SP",
-          "ibge": "3550308",
-          "gia": "1004",
-          "ddd": "11",
-          "siafi": "7107"
-        }`
-        return mockResponse(http.StatusOK, viaCEPResponse), nil
-      } else if strings.Contains(req.URL.String(), "weatherapi.com") {
-        // Mock WeatherAPI response
-        weatherResponse := `{
-          "location": {
-            "name": "São Paulo",
-            "region": "Sao Paulo",
-            "country": "Brazil"
-          },
-          "current": {
-            "temp_c": 25.0
-          }
-        }`
-        return mockResponse(http.StatusOK, weatherResponse), nil
-      }
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusInternalServerError, `<html><body>Internal Server Error</body></html>`), nil
+  })
 
-      // Default response for unexpected URLs
-      return mockResponse(http.StatusInternalServerError, "{}"), nil
-    },
+  _, err := NewServer(testConfig(), mockClient).getLocationFromCEP(context.Background(), "01001000")
+  if !errors.Is(err, ErrCEPUnavailable) {
+    t.Fatalf("Expected ErrCEPUnavailable, got %v", err)
   }
 
-  // Set our mock client as the default client
-  httpClient = mockClient
+  var upstreamErr *UpstreamError
+  if !errors.As(err, &upstreamErr) || upstreamErr.Provider != providerViaCEP {
+    t.Errorf("Expected a ViaCEP upstream error, got %v", err)
+  }
 
-  // Create a request with a valid CEP
-  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
-  if err != nil {
-    t.Fatal(err)
+  if !strings.Contains(err.Error(), "unexpected status 500") {
+    t.Errorf("Expected the error to report the status, got %v", err)
   }
+}
 
-  // Create a ResponseRecorder to record the response
-  rr := httptest.NewRecorder()
-  handler := http.HandlerFunc(temperatureHandler)
+func TestUpstreamInvalidJSON(t *testing.T) {
+  invalid := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, `{"localidade": `), nil
+  })
+  s := NewServer(testConfig(), invalid)
 
-  // Call the handler
-  handler.ServeHTTP(rr, req)
+  ctx := context.Background()
+  tests := []struct {
+    name     string
+    lookup   func() error
+    sentinel error
+    contains []string
+  }{
+    {"ViaCEP", func() error {
+      _, err := s.getLocationFromCEP(ctx, "01001000")
+      return err
+    }, ErrCEPUnavailable, []string{"viacep:", `cep "01001000"`}},
+    {"BrasilAPI", func() error {
+      _, err := s.getLocationFromBrasilAPI(ctx, "01001000")
+      return err
+    }, ErrCEPUnavailable, []string{"brasilapi:", `cep "01001000"`}},
+    {"WeatherAPI", func() error {
+      _, err := s.getTemperatureFromLocation(ctx, "São Paulo", "")
+      return err
+    }, ErrWeatherUnavailable, []string{"weatherapi:", `city "São Paulo"`}},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      err := tt.lookup()
+      if !errors.Is(err, ErrInvalidUpstreamBody) {
+        t.Fatalf("Expected ErrInvalidUpstreamBody, got %v", err)
+      }
+      if !errors.Is(err, tt.sentinel) {
+        t.Errorf("Expected %v to still match, got %v", tt.sentinel, err)
+      }
+
+      var syntaxErr *json.SyntaxError
+      var typeErr *json.UnmarshalTypeError
+      if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) && !errors.Is(err, io.ErrUnexpectedEOF) {
+        t.Errorf("Expected the decoder's error to stay reachable, got %v", err)
+      }
+
+      for _, part := range tt.contains {
+        if !strings.Contains(err.Error(), part) {
+          t.Errorf("Expected the error to contain %q, got %q", part, err.Error())
+        }
+      }
+    })
+  }
+}
+
+func TestGetLocationFromCEPRateLimited(t *testing.T) {
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    resp := mockResponse(http.StatusTooManyRequests, `<html><body>Too Many Requests</body></html>`)
+    resp.Header.Set("Retry-After", "120")
+    return resp, nil
+  })
+
+  _, err := NewServer(testConfig(), mockClient).getLocationFromCEP(context.Background(), "01001000")
+  if !errors.Is(err, ErrUpstreamRateLimited) {
+    t.Fatalf("Expected ErrUpstreamRateLimited, got %v", err)
+  }
+
+  var rateLimited *RateLimitedError
+  if !errors.As(err, &rateLimited) || rateLimited.RetryAfter != 2*time.Minute {
+    t.Errorf("Expected a 2m Retry-After from ViaCEP, got %v", err)
+  }
+}
+
+func TestTemperatureHandlerCEPRateLimited(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  s := NewServer(testConfig(), nil)
+
+  tests := []struct {
+    name               string
+    retryAfter         string
+    expectedRetryAfter string
+  }{
+    {"ViaCEP Retry-After", "120", "120"},
+    {"Default Retry-After", "", "30"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        if req.URL.Host == "brasilapi.com.br" {
+          return mockResponse(http.StatusInternalServerError, `{}`), nil
+        }
+        resp := mockResponse(http.StatusTooManyRequests, `<html><body>Too Many Requests</body></html>`)
+        if tt.retryAfter != "" {
+          resp.Header.Set("Retry-After", tt.retryAfter)
+        }
+        return resp, nil
+      })
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusServiceUnavailable {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+      }
+
+      if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tt.expectedRetryAfter {
+        t.Errorf("Expected Retry-After %q, got %q", tt.expectedRetryAfter, retryAfter)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      expectedMessage := "limite de requisições do serviço de CEP atingido, tente novamente mais tarde"
+      if response.Message != expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerRetriesQualifiedCity(t *testing.T) {
+  var weatherQueries []string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, `{"localidade": "Bom Jesus", "uf": "PI"}`), nil
+    }
+    q := req.URL.Query().Get("q")
+    weatherQueries = append(weatherQueries, q)
+    if q != "Bom Jesus, PI, Brazil" {
+      return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+    }
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 31.0}}`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=64900000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
 
-  // Check the status code
   if status := rr.Code; status != http.StatusOK {
-    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  expectedQueries := []string{"Bom Jesus", "Bom Jesus, PI, Brazil"}
+  if !reflect.DeepEqual(weatherQueries, expectedQueries) {
+    t.Errorf("Expected WeatherAPI queries %q, got %q", expectedQueries, weatherQueries)
   }
 
-  // Check the response body
   var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+  if response.TempC != 31.0 || response.City != "Bom Jesus" {
+    t.Errorf("Expected 31 C in Bom Jesus, got %v C in %q", response.TempC, response.City)
+  }
+}
+
+func TestTemperatureHandlerCEPUpstreamError(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusInternalServerError, `<html><body>Internal Server Error</body></html>`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusBadGateway {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadGateway)
+  }
+
+  var response ErrorResponse
   if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
     t.Errorf("Failed to parse response body: %v", err)
   }
 
-  // Check temperature values
-  expectedTempC := 25.0
-  expectedTempF := celsiusToFahrenheit(expectedTempC)
-  expectedTempK := celsiusToKelvin(expectedTempC)
+  expectedMessage := "falha ao consultar o CEP"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
 
-  if response.TempC != expectedTempC {
-    t.Errorf("Expected temp_C to be %f, got %f", expectedTempC, response.TempC)
+func TestGetTemperatureFromLocation(t *testing.T) {
+  // Test case 1: Valid location
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    validResponse := `{
+      "location": {
+        "name": "São Paulo",
+        "region": "Sao Paulo",
+        "country": "Brazil"
+      },
+      "current": {
+        "temp_c": 25.0
+      }
+    }`
+    return mockResponse(http.StatusOK, validResponse), nil
+  })
+  s := NewServer(testConfig(), mockClient)
+
+  weather, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", "")
+  if err != nil {
+    t.Errorf("Expected no error, got %v", err)
   }
 
-  if response.TempF != expectedTempF {
-    t.Errorf("Expected temp_F to be %f, got %f", expectedTempF, response.TempF)
+  if weather.Current.TempC != 25.0 {
+    t.Errorf("Expected temperature to be 25.0, got %f", weather.Current.TempC)
   }
 
-  if response.TempK != expectedTempK {
-    t.Errorf("Expected temp_K to be %f, got %f", expectedTempK, response.TempK)
+  // Test case 2: API error
+  s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+  })
+
+  _, err = s.getTemperatureFromLocation(context.Background(), "NonExistentCity", "")
+  if err == nil {
+    t.Errorf("Expected error for invalid location, got nil")
   }
 }
 
-func TestTemperatureHandlerCEPNotFound(t *testing.T) {
-  // Save original HTTP client and restore it after test
-  originalClient := httpClient
-  defer func() { httpClient = originalClient }()
+func TestGetTemperatureFromLocationStructuredError(t *testing.T) {
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`), nil
+  })
 
-  // Create a mock client that returns a CEP not found error
-  mockClient := &MockHTTPClient{
-    DoFunc: func(req *http.Request) (*http.Response, error) {
-      // Mock ViaCEP response for not found CEP
-      return mockResponse(http.StatusOK, `{"erro": true}`), nil
-    },
+  _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "Atlantis", "")
+
+  var apiErr *WeatherAPIError
+  if !errors.As(err, &apiErr) {
+    t.Fatalf("Expected a *WeatherAPIError, got %v", err)
   }
 
-  // Set our mock client as the default client
-  httpClient = mockClient
+  if apiErr.Code != weatherAPINoMatchingLocation || apiErr.Message != "No matching location found." {
+    t.Errorf("Expected code 1006 with its message, got %+v", apiErr)
+  }
 
-  // Create a request with a valid but non-existent CEP
-  req, err := http.NewRequest("GET", "/temperature?cep=99999999", nil)
+  if !strings.Contains(err.Error(), "No matching location found.") {
+    t.Errorf("Expected error to include the upstream message, got %q", err.Error())
+  }
+
+  if !isWeatherLocationNotFound(err) {
+    t.Error("Expected isWeatherLocationNotFound to be true")
+  }
+}
+
+func TestTemperatureHandlerWeatherAPIErrors(t *testing.T) {
+  s := NewServer(testConfig(), nil)
+
+  tests := []struct {
+    name            string
+    status          int
+    body            string
+    expectedStatus  int
+    expectedMessage string
+  }{
+    {"Location Not Found", http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`, http.StatusNotFound, "não foi possível encontrar o CEP"},
+    {"Invalid API Key", http.StatusUnauthorized, `{"error":{"code":2006,"message":"API key is invalid."}}`, http.StatusBadGateway, "falha ao obter os dados de temperatura"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      s.weatherBreaker = newWeatherBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+      s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        if req.URL.Host == "viacep.com.br" {
+          return mockResponse(http.StatusOK, mockViaCEPBody), nil
+        }
+        return mockResponse(tt.status, tt.body), nil
+      })
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expectedStatus {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerWeatherUnreachable(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+
+  upstreamRetryBaseDelay = time.Millisecond
+
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return nil, errors.New("connection refused")
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
   if err != nil {
     t.Fatal(err)
   }
 
-  // Create a ResponseRecorder to record the response
   rr := httptest.NewRecorder()
-  handler := http.HandlerFunc(temperatureHandler)
-
-  // Call the handler
-  handler.ServeHTTP(rr, req)
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
 
-  // Check the status code
-  if status := rr.Code; status != http.StatusNotFound {
-    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+  if status := rr.Code; status != http.StatusBadGateway {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadGateway)
   }
 
-  // Check the response body
   var response ErrorResponse
   if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
     t.Errorf("Failed to parse response body: %v", err)
   }
 
-  expectedMessage := "can not find zipcode"
-  if response.Message != expectedMessage {
-    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  if response.Message != "falha ao obter os dados de temperatura" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "falha ao obter os dados de temperatura")
   }
 }
 
-func TestHealthCheckHandler(t *testing.T) {
-  // Create a request
-  req, err := http.NewRequest("GET", "/health", nil)
+func TestGetTemperatureFromLocationClassifiesErrors(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return nil, errors.New("connection refused")
+  })
+
+  _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", "")
+  if !errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected connection error to be classified as upstream, got %v", err)
+  }
+
+  _, err = serverWithKeys(nil, mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", "")
+  if err == nil || errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected missing API key to be an internal error, got %v", err)
+  }
+}
+
+func TestGetTemperatureFromLocationInvalidBodies(t *testing.T) {
+  tests := []struct {
+    name        string
+    body        string
+    expectedErr error
+  }{
+    {"Empty Body", ``, errEmptyBody},
+    {"Blank Body", " \n", errEmptyBody},
+    {"Missing Current", `{"location": {"name": "São Paulo"}}`, errMissingTemperature},
+    {"Missing Temperature", `{"current": {"humidity": 80}}`, errMissingTemperature},
+    {"Truncated Body", `{"current": {"temp_c": 2`, ErrWeatherUnavailable},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        return mockResponse(http.StatusOK, tt.body), nil
+      })
+
+      _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", "")
+      if !errors.Is(err, tt.expectedErr) {
+        t.Errorf("Expected %v, got %v", tt.expectedErr, err)
+      }
+      if !errors.Is(err, ErrWeatherUnavailable) {
+        t.Errorf("Expected the error to match ErrWeatherUnavailable, got %v", err)
+      }
+    })
+  }
+}
+
+func TestUpstreamBodyTooLarge(t *testing.T) {
+  cfg := testConfig()
+  cfg.MaxUpstreamBodyBytes = 64
+
+  large := `{"current": {"temp_c": 25.0}, "padding": "` + strings.Repeat("x", 64) + `"}`
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, large), nil
+  })
+  s := NewServer(cfg, mockClient)
+
+  _, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", "")
+  if !errors.Is(err, errBodyTooLarge) || !errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected an oversized WeatherAPI body to fail with errBodyTooLarge, got %v", err)
+  }
+
+  _, err = s.getLocationFromCEP(context.Background(), "01001000")
+  if !errors.Is(err, errBodyTooLarge) || !errors.Is(err, ErrCEPUnavailable) {
+    t.Errorf("Expected an oversized ViaCEP body to fail with errBodyTooLarge, got %v", err)
+  }
+
+  // A body right at the limit is still read in full.
+  exact := `{"current": {"temp_c": 25.0}}`
+  exact += strings.Repeat(" ", 64-len(exact))
+  s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, exact), nil
+  })
+  if _, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", ""); err != nil {
+    t.Errorf("Expected a body at the limit to be accepted, got %v", err)
+  }
+}
+
+func TestGetTemperatureFromLocationZeroDegrees(t *testing.T) {
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 0.0}}`), nil
+  })
+
+  weather, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "Curitiba", "")
+  if err != nil {
+    t.Fatalf("Expected a real 0.0 reading to be accepted, got %v", err)
+  }
+
+  if weather.Current.TempC != 0 {
+    t.Errorf("Expected 0 C, got %v", weather.Current.TempC)
+  }
+}
+
+func TestTemperatureHandlerEmptyWeatherBody(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, ``))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
   if err != nil {
     t.Fatal(err)
   }
 
-  // Create a ResponseRecorder to record the response
   rr := httptest.NewRecorder()
-  handler := http.HandlerFunc(healthCheckHandler)
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
 
-  // Call the handler
-  handler.ServeHTTP(rr, req)
+  if status := rr.Code; status != http.StatusBadGateway {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadGateway)
+  }
+}
 
-  // Check the status code
-  if status := rr.Code; status != http.StatusOK {
-    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+func TestGetTemperatureFromLocationEncodesCity(t *testing.T) {
+  var rawQuery, city string
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    rawQuery = req.URL.RawQuery
+    city = req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0}}`), nil
+  })
+
+  if _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", ""); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
   }
 
-  // Check the response body
-  expected := "OK"
-  if rr.Body.String() != expected {
-    t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+  if !strings.Contains(rawQuery, "q=S%C3%A3o+Paulo") {
+    t.Errorf("Expected city to be URL-encoded in the query, got %s", rawQuery)
+  }
+
+  if city != "São Paulo" {
+    t.Errorf("Expected decoded city to be 'São Paulo', got %q", city)
+  }
+}
+
+func TestGetTemperatureFromLocationUsesHTTPS(t *testing.T) {
+  var requestURL *url.URL
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    requestURL = req.URL
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  })
+
+  if _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "Recife", ""); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if requestURL.Scheme != "https" {
+    t.Errorf("Expected the API key to be sent over https, got %s", requestURL.String())
+  }
+
+  if requestURL.Host != "api.weatherapi.com" || requestURL.Path != "/v1/current.json" {
+    t.Errorf("Expected https://api.weatherapi.com/v1/current.json, got %s", requestURL.String())
+  }
+}
+
+func TestConfigurableBaseURLs(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherAPIBaseURL = "http://weather.staging.local/v1"
+  cfg.ViaCEPBaseURL = "http://viacep.staging.local/ws"
+
+  var requested []string
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    requested = append(requested, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+    if req.URL.Host == "viacep.staging.local" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  })
+  s := NewServer(cfg, mockClient)
+
+  if _, err := s.getLocationFromCEP(context.Background(), "01001000"); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if _, err := s.getTemperatureFromLocation(context.Background(), "Recife", ""); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  expected := []string{
+    "http://viacep.staging.local/ws/01001000/json/",
+    "http://weather.staging.local/v1/current.json",
+  }
+  if len(requested) != len(expected) {
+    t.Fatalf("Expected %d requests, got %v", len(expected), requested)
+  }
+  for i := range expected {
+    if requested[i] != expected[i] {
+      t.Errorf("Expected request to %s, got %s", expected[i], requested[i])
+    }
+  }
+}
+
+func TestFetchFunctionsHonorContextCancellation(t *testing.T) {
+  cfg := defaultConfig()
+  cfg.HTTPClientTimeout = 5 * time.Second
+  client := newHTTPClient(cfg)
+  s := NewServer(testConfig(), client)
+  client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+    <-req.Context().Done()
+    return nil, req.Context().Err()
+  })
+
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+
+  if _, err := s.getLocationFromCEP(ctx, "01001000"); !errors.Is(err, context.Canceled) {
+    t.Errorf("getLocationFromCEP: expected context.Canceled, got %v", err)
+  }
+
+  if _, err := s.getTemperatureFromLocation(ctx, "São Paulo", ""); !errors.Is(err, context.Canceled) {
+    t.Errorf("getTemperatureFromLocation: expected context.Canceled, got %v", err)
+  }
+}
+
+func TestTemperatureHandlerInvalidCEP(t *testing.T) {
+  // Create a request with an invalid CEP
+  req, err := http.NewRequest("GET", "/temperature?cep=1234567", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Create a ResponseRecorder to record the response
+  rr := httptest.NewRecorder()
+  handler := http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler)
+
+  // Call the handler
+  handler.ServeHTTP(rr, req)
+
+  // Check the status code
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+
+  // Check the response body
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "o CEP deve ter 8 dígitos"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
+
+func TestTemperatureHandlerHead(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  // HEAD is answered by the GET route; net/http drops the body
+  server := httptest.NewServer(s.routes())
+  defer server.Close()
+
+  tests := []struct {
+    name     string
+    url      string
+    expected int
+  }{
+    {"Valid CEP", "/temperature?cep=01001000", http.StatusOK},
+    {"Invalid CEP", "/temperature?cep=123", http.StatusUnprocessableEntity},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      get, err := http.Get(server.URL + tt.url)
+      if err != nil {
+        t.Fatal(err)
+      }
+      getBody, _ := io.ReadAll(get.Body)
+      get.Body.Close()
+
+      resp, err := http.Head(server.URL + tt.url)
+      if err != nil {
+        t.Fatal(err)
+      }
+      body, _ := io.ReadAll(resp.Body)
+      resp.Body.Close()
+
+      if resp.StatusCode != tt.expected {
+        t.Errorf("handler returned wrong status code: got %v want %v", resp.StatusCode, tt.expected)
+      }
+      if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+        t.Errorf("Expected Content-Type application/json, got %q", contentType)
+      }
+      if expected := strconv.Itoa(len(getBody)); resp.Header.Get("Content-Length") != expected {
+        t.Errorf("Expected the GET Content-Length %s, got %q", expected, resp.Header.Get("Content-Length"))
+      }
+      if len(body) != 0 {
+        t.Errorf("Expected an empty body, got %q", body)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerMethodNotAllowed(t *testing.T) {
+  req, err := http.NewRequest("POST", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  NewServer(defaultConfig(), nil).routes().ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusMethodNotAllowed {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+  }
+
+  if allow := rr.Header().Get("Allow"); allow != "GET, HEAD" {
+    t.Errorf("Expected Allow header to be %s, got %q", "GET, HEAD", allow)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "método não permitido"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
+
+func TestTemperatureHandlerSuccess(t *testing.T) {
+  // Inject the API key for testing
+
+  // Create a mock client that handles both API calls
+  mockClient := &MockHTTPClient{
+    DoFunc: func(req *http.Request) (*http.Response, error) {
+      // Check which API is being called based on the URL
+      if strings.Contains(req.URL.String(), "viacep.com.br") {
+        // Mock ViaCEP response
+        viaCEPResponse := `{
+          "cep": "01001000",
+          "logradouro": "Praça da Sé",
+          "complemento": "lado ímpar",
+          "bairro": "Sé",
+          "localidade": "São Paulo",
+          "uf": "SP",
+          "ibge": "3550308",
+          "gia": "1004",
+          "ddd": "11",
+          "siafi": "7107"
+        }`
+        return mockResponse(http.StatusOK, viaCEPResponse), nil
+      } else if strings.Contains(req.URL.String(), "weatherapi.com") {
+        // Mock WeatherAPI response
+        weatherResponse := `{
+          "location": {
+            "name": "São Paulo",
+            "region": "Sao Paulo",
+            "country": "Brazil"
+          },
+          "current": {
+            "temp_c": 25.0
+          }
+        }`
+        return mockResponse(http.StatusOK, weatherResponse), nil
+      }
+
+      // Default response for unexpected URLs
+      return mockResponse(http.StatusInternalServerError, "{}"), nil
+    },
+  }
+
+  // Set our mock client as the default client
+  s := NewServer(testConfig(), mockClient)
+
+  // Create a request with a valid CEP
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Create a ResponseRecorder to record the response
+  rr := httptest.NewRecorder()
+  handler := http.HandlerFunc(s.temperatureHandler)
+
+  // Call the handler
+  handler.ServeHTTP(rr, req)
+
+  // Check the status code
+  if status := rr.Code; status != http.StatusOK {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  // Check the response body
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  // Check temperature values
+  expectedTempC := 25.0
+  expectedTempF := celsiusToFahrenheit(expectedTempC)
+  expectedTempK := celsiusToKelvin(expectedTempC)
+  expectedTempR := celsiusToRankine(expectedTempC)
+
+  if response.TempC != expectedTempC {
+    t.Errorf("Expected temp_C to be %f, got %f", expectedTempC, response.TempC)
+  }
+
+  if response.TempF != expectedTempF {
+    t.Errorf("Expected temp_F to be %f, got %f", expectedTempF, response.TempF)
+  }
+
+  if response.TempK != expectedTempK {
+    t.Errorf("Expected temp_K to be %f, got %f", expectedTempK, response.TempK)
+  }
+
+  if response.TempR != expectedTempR {
+    t.Errorf("Expected temp_R to be %f, got %f", expectedTempR, response.TempR)
+  }
+
+  if response.City != "São Paulo" {
+    t.Errorf("Expected city to be 'São Paulo', got '%s'", response.City)
+  }
+}
+
+func TestTemperatureHandlerCEPNotFound(t *testing.T) {
+  // Create a mock client that returns a CEP not found error
+  mockClient := &MockHTTPClient{
+    DoFunc: func(req *http.Request) (*http.Response, error) {
+      // Mock ViaCEP response for not found CEP
+      return mockResponse(http.StatusOK, `{"erro": true}`), nil
+    },
+  }
+
+  // Set our mock client as the default client
+  s := NewServer(defaultConfig(), mockClient)
+
+  // Create a request with a valid but non-existent CEP
+  req, err := http.NewRequest("GET", "/temperature?cep=99999999", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Create a ResponseRecorder to record the response
+  rr := httptest.NewRecorder()
+  handler := http.HandlerFunc(s.temperatureHandler)
+
+  // Call the handler
+  handler.ServeHTTP(rr, req)
+
+  // Check the status code
+  if status := rr.Code; status != http.StatusNotFound {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+  }
+
+  // Check the response body
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "não foi possível encontrar o CEP"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
+
+func TestHealthCheckHandler(t *testing.T) {
+  // Create a request
+  req, err := http.NewRequest("GET", "/health", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Create a ResponseRecorder to record the response
+  rr := httptest.NewRecorder()
+  handler := http.HandlerFunc(healthCheckHandler)
+
+  // Call the handler
+  handler.ServeHTTP(rr, req)
+
+  // Check the status code
+  if status := rr.Code; status != http.StatusOK {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  // Check the response body
+  expected := "OK"
+  if rr.Body.String() != expected {
+    t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+  }
+}
+
+func TestTemperatureHandlerHyphenatedCEP(t *testing.T) {
+  var requestedURL string
+  s := NewServer(testConfig(), &MockHTTPClient{
+    DoFunc: func(req *http.Request) (*http.Response, error) {
+      if strings.Contains(req.URL.String(), "viacep.com.br") {
+        requestedURL = req.URL.String()
+        return mockResponse(http.StatusOK, `{"cep": "01001-000", "localidade": "São Paulo", "uf": "SP"}`), nil
+      }
+      return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0}}`), nil
+    },
+  })
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001-000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if !strings.Contains(requestedURL, "/ws/01001000/json/") {
+    t.Errorf("Expected ViaCEP to be called with the normalized CEP, got %s", requestedURL)
+  }
+}
+
+func TestTemperatureHandlerRoundsValues(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"current": {"temp_c": 25.3}}`))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.TempF != 77.54 {
+    t.Errorf("Expected temp_F to be rounded to 77.54, got %v", response.TempF)
+  }
+
+  if response.TempK != 298.45 {
+    t.Errorf("Expected temp_K to be rounded to 298.45, got %v", response.TempK)
+  }
+}
+
+func TestTemperatureHandlerCity(t *testing.T) {
+  var weatherQuery string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host != "api.weatherapi.com" {
+      t.Errorf("Expected only WeatherAPI to be called, got %s", req.URL.Host)
+    }
+    weatherQuery = req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, `{"location": {"name": "London"}, "current": {"temp_c": 12.0}}`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?city=London", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if weatherQuery != "London" {
+    t.Errorf("Expected WeatherAPI to be queried for London, got %q", weatherQuery)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.TempC != 12.0 || response.City != "London" {
+    t.Errorf("Expected 12 C in London, got %v C in %q", response.TempC, response.City)
+  }
+}
+
+func TestTemperatureHandlerLocationParameters(t *testing.T) {
+  tests := []struct {
+    name            string
+    query           string
+    expectedMessage string
+  }{
+    {"Both Present", "?cep=01001000&city=London", "cep, city e ibge são mutuamente exclusivos"},
+    {"CEP And IBGE", "?cep=01001000&ibge=3550308", "cep, city e ibge são mutuamente exclusivos"},
+    {"Neither Present", "", "o parâmetro cep, city ou ibge é obrigatório"},
+    {"Source IP With City", "?source=ip&city=London", "source=ip não pode ser combinado com cep, city ou ibge"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusBadRequest {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Errorf("Failed to parse response body: %v", err)
+      }
+
+      if response.Message != tt.expectedMessage {
+        t.Errorf("handler returned unexpected body: got %v want %v", response.Message, tt.expectedMessage)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerExtended(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"current": {"temp_c": 25.0, "humidity": 62, "wind_kph": 14.4}}`))
+
+  tests := []struct {
+    name           string
+    query          string
+    wantConditions bool
+  }{
+    {"Default", "", false},
+    {"Extended", "&extended=true", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      var response TemperatureResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if !tt.wantConditions {
+        if response.Conditions != nil || strings.Contains(rr.Body.String(), "conditions") {
+          t.Errorf("Expected no conditions in the default response, got %s", rr.Body.String())
+        }
+        return
+      }
+
+      if response.Conditions == nil {
+        t.Fatalf("Expected conditions in the extended response, got %s", rr.Body.String())
+      }
+
+      if response.Conditions.Humidity != 62 || response.Conditions.WindKph != 14.4 {
+        t.Errorf("Expected humidity 62 and wind 14.4 kph, got %+v", response.Conditions)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerAirQuality(t *testing.T) {
+  var aqiParam string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    aqiParam = req.URL.Query().Get("aqi")
+    if aqiParam != "yes" {
+      return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0}}`), nil
+    }
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0, "air_quality": {"co": 223.6, "pm2_5": 12.4, "pm10": 18.9}}}`), nil
+  }))
+
+  tests := []struct {
+    name           string
+    query          string
+    wantAQIParam   string
+    wantAirQuality bool
+  }{
+    {"Default", "&extended=true", "no", false},
+    {"AQI", "&extended=true&aqi=true", "yes", true},
+    {"AQI without extended", "&aqi=true", "no", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+      if aqiParam != tt.wantAQIParam {
+        t.Errorf("Expected aqi=%s upstream, got aqi=%s", tt.wantAQIParam, aqiParam)
+      }
+
+      var response TemperatureResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if !tt.wantAirQuality {
+        if strings.Contains(rr.Body.String(), "air_quality") {
+          t.Errorf("Expected no air_quality, got %s", rr.Body.String())
+        }
+        return
+      }
+
+      if response.Conditions == nil || response.Conditions.AirQuality == nil {
+        t.Fatalf("Expected air_quality in the conditions, got %s", rr.Body.String())
+      }
+      if aq := response.Conditions.AirQuality; aq.PM25 != 12.4 || aq.PM10 != 18.9 {
+        t.Errorf("Expected pm2_5 12.4 and pm10 18.9, got %+v", aq)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerInvalidAQI(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&aqi=maybe", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+}
+
+func TestTemperatureHandlerFeelsLike(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"current": {"temp_c": 25.0, "feelslike_c": 27.0}}`))
+
+  for _, query := range []string{"", "&extended=true"} {
+    req, err := http.NewRequest("GET", "/temperature?cep=01001000"+query, nil)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+    if status := rr.Code; status != http.StatusOK {
+      t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+    }
+
+    if query == "" {
+      if strings.Contains(rr.Body.String(), "feels_like") {
+        t.Errorf("Expected no feels like fields in the default response, got %s", rr.Body.String())
+      }
+      continue
+    }
+
+    var response TemperatureResponse
+    if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+      t.Fatalf("Failed to parse response body: %v", err)
+    }
+
+    if response.Conditions == nil {
+      t.Fatalf("Expected conditions in the extended response, got %s", rr.Body.String())
+    }
+
+    got := response.Conditions
+    if got.FeelsLikeC != 27.0 || got.FeelsLikeF != 80.6 || got.FeelsLikeK != 300.15 {
+      t.Errorf("Expected feels like 27 C / 80.6 F / 300.15 K, got %v / %v / %v", got.FeelsLikeC, got.FeelsLikeF, got.FeelsLikeK)
+    }
+  }
+}
+
+func TestNormalizeIconURL(t *testing.T) {
+  tests := []struct {
+    icon     string
+    expected string
+  }{
+    {"//cdn.weatherapi.com/weather/64x64/day/113.png", "https://cdn.weatherapi.com/weather/64x64/day/113.png"},
+    {"http://cdn.weatherapi.com/weather/64x64/day/113.png", "https://cdn.weatherapi.com/weather/64x64/day/113.png"},
+    {"https://cdn.weatherapi.com/weather/64x64/day/113.png", "https://cdn.weatherapi.com/weather/64x64/day/113.png"},
+    {"", ""},
+  }
+
+  for _, tt := range tests {
+    if got := normalizeIconURL(tt.icon); got != tt.expected {
+      t.Errorf("normalizeIconURL(%q) = %q; want %q", tt.icon, got, tt.expected)
+    }
+  }
+}
+
+func TestTemperatureHandlerConditionIcon(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"current": {"temp_c": 25.0, "condition": {"text": "Sunny", "icon": "//cdn.weatherapi.com/weather/64x64/day/113.png"}}}`))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&extended=true", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+  if response.Conditions == nil {
+    t.Fatalf("Expected conditions in the extended response, got %s", rr.Body.String())
+  }
+  if expected := "https://cdn.weatherapi.com/weather/64x64/day/113.png"; response.Conditions.IconURL != expected {
+    t.Errorf("Expected icon_url %q, got %q", expected, response.Conditions.IconURL)
+  }
+  if response.Conditions.Description != "Sunny" {
+    t.Errorf("Expected description Sunny, got %q", response.Conditions.Description)
+  }
+}
+
+func TestTemperatureHandlerAddress(t *testing.T) {
+  viaCEPBody := `{"cep": "01001-000", "logradouro": "Praça da Sé", "bairro": "Sé", "localidade": "São Paulo", "uf": "SP"}`
+  s := NewServer(testConfig(), mockUpstreamClient(viaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    name        string
+    query       string
+    wantAddress bool
+  }{
+    {"Default", "", false},
+    {"Address", "&address=true", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      var response TemperatureResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if !tt.wantAddress {
+        if response.Location != nil || strings.Contains(rr.Body.String(), "location") {
+          t.Errorf("Expected no location in the default response, got %s", rr.Body.String())
+        }
+        return
+      }
+
+      expected := Address{Logradouro: "Praça da Sé", Bairro: "Sé", Localidade: "São Paulo", UF: "SP"}
+      if response.Location == nil || *response.Location != expected {
+        t.Errorf("Expected location %+v, got %s", expected, rr.Body.String())
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerInvalidAddress(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&address=maybe", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+}
+
+func TestTemperatureHandlerMinimalFormat(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&format=minimal", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  req.Header.Set("Accept", "text/plain")
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+    t.Errorf("Expected Content-Type application/json, got %q", contentType)
+  }
+
+  if body := rr.Body.String(); body != "25.0\n" {
+    t.Errorf("Expected a bare Celsius number, got %q", body)
+  }
+
+  var value float64
+  if err := json.Unmarshal(rr.Body.Bytes(), &value); err != nil || value != 25.0 {
+    t.Errorf("Expected the body to decode as the JSON number 25, got %v (%v)", value, err)
+  }
+}
+
+func TestTemperatureHandlerInvalidFormat(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&format=full", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+}
+
+func TestPrefersPlainText(t *testing.T) {
+  tests := []struct {
+    accept   string
+    expected bool
+  }{
+    {"", false},
+    {"application/json", false},
+    {"*/*", false},
+    {"text/plain", true},
+    {"text/plain; charset=utf-8", true},
+    {"text/html, text/plain;q=0.9", true},
+    {"application/json, text/plain", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.accept, func(t *testing.T) {
+      if got := prefersPlainText(tt.accept); got != tt.expected {
+        t.Errorf("prefersPlainText(%q) = %v, want %v", tt.accept, got, tt.expected)
+      }
+    })
+  }
+}
+
+func TestPrefersXML(t *testing.T) {
+  tests := []struct {
+    accept   string
+    expected bool
+  }{
+    {"", false},
+    {"application/json", false},
+    {"*/*", false},
+    {"application/xml", true},
+    {"text/xml; charset=utf-8", true},
+    {"text/html, application/xml;q=0.9", true},
+    {"text/plain, application/xml", false},
+    {"application/json, application/xml", false},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.accept, func(t *testing.T) {
+      if got := prefersXML(tt.accept); got != tt.expected {
+        t.Errorf("prefersXML(%q) = %v, want %v", tt.accept, got, tt.expected)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerAccept(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    name                string
+    query               string
+    accept              string
+    expectedContentType string
+    expectedBody        string
+  }{
+    {"Default", "cep=01001000", "", "application/json", `{"temp_C":25,"temp_F":77,"temp_K":298.15,"temp_R":536.67,"city":"São Paulo"}` + "\n"},
+    {"JSON", "cep=01001000", "application/json", "application/json", `{"temp_C":25,"temp_F":77,"temp_K":298.15,"temp_R":536.67,"city":"São Paulo"}` + "\n"},
+    {"Plain Text", "cep=01001000&units=c,f,k", "text/plain", "text/plain; charset=utf-8", "25.0C 77.0F 298.15K\n"},
+    {"Plain Text All Units", "cep=01001000", "text/plain", "text/plain; charset=utf-8", "25.0C 77.0F 298.15K 536.67R\n"},
+    {"Plain Text Decimal", "cep=01001000&units=c,k&notation=decimal", "text/plain", "text/plain; charset=utf-8", "25.0C 298.15K\n"},
+    {"Plain Text Scientific", "cep=01001000&notation=scientific", "text/plain", "text/plain; charset=utf-8", "2.5e+01C 7.7e+01F 2.9815e+02K 5.3667e+02R\n"},
+    {"JSON Scientific", "cep=01001000&notation=scientific", "application/json", "application/json", `{"temp_C":25,"temp_F":77,"temp_K":298.15,"temp_R":536.67,"city":"São Paulo"}` + "\n"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.accept != "" {
+        req.Header.Set("Accept", tt.accept)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+        t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, contentType)
+      }
+
+      if body := rr.Body.String(); body != tt.expectedBody {
+        t.Errorf("handler returned unexpected body: got %q want %q", body, tt.expectedBody)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerLang(t *testing.T) {
+  var weatherQuery url.Values
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    weatherQuery = req.URL.Query()
+    return mockResponse(http.StatusOK, `{"current": {"temp_c": 25.0, "humidity": 62, "wind_kph": 14.4, "condition": {"text": "Parcialmente nublado"}}}`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&lang=PT&extended=true", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if lang := weatherQuery.Get("lang"); lang != "pt" {
+    t.Errorf("Expected lang=pt in the WeatherAPI request, got %q", lang)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.Conditions == nil || response.Conditions.Description != "Parcialmente nublado" {
+    t.Errorf("Expected localized description in conditions, got %s", rr.Body.String())
+  }
+
+  // Without lang the parameter is not sent upstream
+  req, err = http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr = httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if _, ok := weatherQuery["lang"]; ok {
+    t.Errorf("Expected no lang in the WeatherAPI request, got %v", weatherQuery)
+  }
+}
+
+func TestTemperatureHandlerInvalidLang(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&lang=xx", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  if response.Message != "lang inválido" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "lang inválido")
+  }
+}
+
+func TestTemperatureHandlerXML(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"current": {"temp_c": 25.0, "humidity": 62, "wind_kph": 14.4}}`))
+
+  tests := []struct {
+    name   string
+    query  string
+    accept string
+  }{
+    {"Format Parameter", "cep=01001000&units=c,k&extended=true&address=true&format=xml", ""},
+    {"Accept Header", "cep=01001000&units=c,k&extended=true&address=true", "application/xml, application/json"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.accept != "" {
+        req.Header.Set("Accept", tt.accept)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+      if contentType := rr.Header().Get("Content-Type"); contentType != "application/xml" {
+        t.Errorf("Expected Content-Type application/xml, got %q", contentType)
+      }
+
+      body := rr.Body.String()
+      if !strings.HasPrefix(body, xml.Header+"<temperature>") {
+        t.Errorf("Expected an XML document with a <temperature> root, got %q", body)
+      }
+      if strings.Contains(body, "temp_F") || strings.Contains(body, "temp_R") {
+        t.Errorf("Expected only the selected units, got %q", body)
+      }
+
+      var response TemperatureResponse
+      if err := xml.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.TempC != 25 || response.TempK != 298.15 || response.City != "São Paulo" {
+        t.Errorf("Expected 25 C and 298.15 K in São Paulo, got %+v", response)
+      }
+      if response.Conditions == nil || response.Conditions.Humidity != 62 || response.Conditions.WindKph != 14.4 {
+        t.Errorf("Expected the conditions to round-trip, got %+v", response.Conditions)
+      }
+      if response.Location == nil || response.Location.UF != "SP" {
+        t.Errorf("Expected the location to round-trip, got %+v", response.Location)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerPretty(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    name         string
+    query        string
+    expectedBody string
+  }{
+    {"Default", "cep=01001000&units=c", `{"temp_C":25,"city":"São Paulo"}` + "\n"},
+    {"Pretty", "cep=01001000&units=c&pretty=true", "{\n  \"temp_C\": 25,\n  \"city\": \"São Paulo\"\n}\n"},
+    {"Pretty Error", "cep=123&pretty=true", "{\n  \"message\": \"o CEP deve ter 8 dígitos\"\n}\n"},
+    {"Invalid Pretty", "cep=01001000&pretty=maybe", `{"message":"pretty inválido"}` + "\n"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if body := rr.Body.String(); body != tt.expectedBody {
+        t.Errorf("handler returned unexpected body: got %q want %q", body, tt.expectedBody)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerInvalidNotation(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&notation=engineering", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  if response.Message != "notation inválido" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "notation inválido")
+  }
+}
+
+func TestWeatherAPIResponseObservedAt(t *testing.T) {
+  tests := []struct {
+    name        string
+    body        string
+    expected    string
+    expectError bool
+  }{
+    {"With Time Zone", `{"location": {"tz_id": "America/Sao_Paulo"}, "current": {"last_updated": "2024-01-02 15:04"}}`, "2024-01-02T15:04:00-03:00", false},
+    {"Without Time Zone", `{"current": {"last_updated": "2024-01-02 15:04"}}`, "2024-01-02T15:04:00Z", false},
+    {"Missing", `{"current": {}}`, "", false},
+    {"Malformed", `{"current": {"last_updated": "02/01/2024 15:04"}}`, "", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      var weather WeatherAPIResponse
+      if err := json.Unmarshal([]byte(tt.body), &weather); err != nil {
+        t.Fatal(err)
+      }
+
+      observedAt, err := weather.observedAt()
+      if (err != nil) != tt.expectError {
+        t.Fatalf("observedAt() error = %v; expectError %v", err, tt.expectError)
+      }
+      if observedAt != tt.expected {
+        t.Errorf("observedAt() = %q; want %q", observedAt, tt.expected)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerObservedAt(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{
+    "location": {"name": "São Paulo", "tz_id": "America/Sao_Paulo"},
+    "current": {"last_updated": "2024-01-02 15:04", "temp_c": 25.0}
+  }`))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.ObservedAt != "2024-01-02T15:04:00-03:00" {
+    t.Errorf("Expected observed_at 2024-01-02T15:04:00-03:00, got %q", response.ObservedAt)
+  }
+}
+
+func TestTemperatureHandlerCacheControl(t *testing.T) {
+  cfg := testConfig()
+  cfg.CacheMaxAge = 90 * time.Second
+  s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    name                 string
+    query                string
+    expectedStatus       int
+    expectedCacheControl string
+  }{
+    {"Success", "cep=01001000", http.StatusOK, "public, max-age=90"},
+    {"Invalid CEP", "cep=1234567", http.StatusUnprocessableEntity, "no-store"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expectedStatus {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+      }
+
+      if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != tt.expectedCacheControl {
+        t.Errorf("Expected Cache-Control %q, got %q", tt.expectedCacheControl, cacheControl)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerSendsUserAgent(t *testing.T) {
+  tests := []struct {
+    name      string
+    userAgent string
+    expected  string
+  }{
+    {"Default", defaultUserAgent, "cap-temp-go/1.0"},
+    {"Configured", "cap-temp-go-staging/2.0", "cap-temp-go-staging/2.0"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := testConfig()
+      cfg.UserAgent = tt.userAgent
+      s := NewServer(cfg, nil)
+
+      received := map[string]string{}
+      s.client = setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        received[req.URL.Host] = req.Header.Get("User-Agent")
+        if req.URL.Host == "viacep.com.br" {
+          return mockResponse(http.StatusOK, mockViaCEPBody), nil
+        }
+        return mockResponse(http.StatusOK, mockWeatherBody), nil
+      })
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+      if len(received) != 2 {
+        t.Fatalf("Expected requests to ViaCEP and WeatherAPI, got %v", received)
+      }
+      for host, userAgent := range received {
+        if userAgent != tt.expected {
+          t.Errorf("Expected User-Agent %q on the request to %s, got %q", tt.expected, host, userAgent)
+        }
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerErrorShapes(t *testing.T) {
+  tests := []struct {
+    name        string
+    accept      string
+    contentType string
+    problem     bool
+  }{
+    {"Legacy by default", "", "application/json", false},
+    {"Legacy for JSON", "application/json", "application/json", false},
+    {"Problem details", "application/problem+json", "application/problem+json", true},
+    {"Problem details among others", "application/json;q=0.5, application/problem+json", "application/problem+json", true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=123", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.accept != "" {
+        req.Header.Set("Accept", tt.accept)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusUnprocessableEntity {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+      }
+      if contentType := rr.Header().Get("Content-Type"); contentType != tt.contentType {
+        t.Errorf("Expected Content-Type %q, got %q", tt.contentType, contentType)
+      }
+
+      if !tt.problem {
+        var response ErrorResponse
+        if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+          t.Fatalf("Failed to parse response body: %v", err)
+        }
+        if response.Message != "o CEP deve ter 8 dígitos" {
+          t.Errorf("Expected message %q, got %q", "o CEP deve ter 8 dígitos", response.Message)
+        }
+        return
+      }
+
+      var problem ProblemDetails
+      if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      expected := ProblemDetails{
+        Type:   "about:blank",
+        Title:  "Unprocessable Entity",
+        Status: http.StatusUnprocessableEntity,
+        Detail: "o CEP deve ter 8 dígitos",
+      }
+      if problem != expected {
+        t.Errorf("Expected %+v, got %+v", expected, problem)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerPartial(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    switch {
+    case strings.Contains(req.URL.Path, "99999999"):
+      return mockResponse(http.StatusNotFound, `{"erro": true}`), nil
+    case req.URL.Host == "viacep.com.br":
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusInternalServerError, `{}`), nil
+  }))
+
+  tests := []struct {
+    name     string
+    url      string
+    expected int
+  }{
+    {"Weather failure without partial", "/temperature?cep=01001000", http.StatusBadGateway},
+    {"Weather failure with partial", "/temperature?cep=01001000&partial=true", http.StatusOK},
+    {"Unknown CEP with partial", "/temperature?cep=99999999&partial=true", http.StatusNotFound},
+    {"Invalid partial", "/temperature?cep=01001000&partial=maybe", http.StatusUnprocessableEntity},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", tt.url, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expected {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expected)
+      }
+      if tt.expected != http.StatusOK {
+        return
+      }
+
+      var response map[string]interface{}
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      for _, field := range []string{"temp_C", "temp_F", "temp_K", "temp_R"} {
+        if value, ok := response[field]; !ok || value != nil {
+          t.Errorf("Expected %s to be null, got %v", field, value)
+        }
+      }
+      if response["city"] != "São Paulo" {
+        t.Errorf("Expected city São Paulo, got %v", response["city"])
+      }
+      location, ok := response["location"].(map[string]interface{})
+      if !ok || location["uf"] != "SP" {
+        t.Errorf("Expected the resolved location, got %v", response["location"])
+      }
+      if response["weather_error"] != "falha ao obter os dados de temperatura" {
+        t.Errorf("Expected weather_error %q, got %v", "falha ao obter os dados de temperatura", response["weather_error"])
+      }
+      if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "no-store" {
+        t.Errorf("Expected Cache-Control no-store, got %q", cacheControl)
+      }
+    })
+  }
+}
+
+func TestNormalizeCity(t *testing.T) {
+  tests := []struct {
+    city     string
+    expected string
+  }{
+    {"São Paulo", "São Paulo"},
+    {"  são   paulo ", "são paulo"},
+    {"\tRio de\nJaneiro ", "Rio de Janeiro"},
+    {"   ", ""},
+  }
+
+  for _, tt := range tests {
+    if got := normalizeCity(tt.city); got != tt.expected {
+      t.Errorf("normalizeCity(%q) = %q; want %q", tt.city, got, tt.expected)
+    }
+  }
+}
+
+func TestTemperatureHandlerCityNormalization(t *testing.T) {
+  var weatherQuery string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    weatherQuery = req.URL.Query().Get("q")
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  tests := []struct {
+    name     string
+    city     string
+    expected int
+    query    string
+    message  string
+  }{
+    {"Padded city", "  são   PAULO ", http.StatusOK, "são PAULO", ""},
+    {"Whitespace only", "   ", http.StatusBadRequest, "", "city não pode estar em branco"},
+    {"Empty", "", http.StatusBadRequest, "", "city não pode estar em branco"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      weatherQuery = ""
+      req, err := http.NewRequest("GET", "/temperature?city="+url.QueryEscape(tt.city), nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expected {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expected)
+      }
+      if weatherQuery != tt.query {
+        t.Errorf("Expected WeatherAPI to be queried for %q, got %q", tt.query, weatherQuery)
+      }
+      if tt.message == "" {
+        return
+      }
+
+      var response ErrorResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response.Message != tt.message {
+        t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+      }
+    })
   }
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "cep_temp"
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total HTTP requests handled, by handler and status code.",
+	}, []string{"handler", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP handler latency in seconds, by handler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	upstreamFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_failures_total",
+		Help:      "Failed calls to upstream APIs, by provider.",
+	}, []string{"provider"})
+
+	upstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of calls to upstream APIs in seconds, retries included, by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+)
+
+// Upstream provider label values.
+const (
+	providerViaCEP         = "viacep"
+	providerBrasilAPI      = "brasilapi"
+	providerWeatherAPI     = "weatherapi"
+	providerIBGE           = "ibge"
+	providerOpenWeatherMap = "openweathermap"
+)
+
+// instrumentHandler records request counts and latency for next under the
+// given handler label.
+func instrumentHandler(name string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerDuration(httpRequestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(httpRequestsTotal.MustCurryWith(labels), next))
+}
+
+// doUpstream sends req to provider with doWithRetry, spreading retries with
+// j, and records how long the call took, retries included.
+func doUpstream(provider string, client HTTPClient, j *jitter, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := doWithRetry(client, req, upstreamRetryAttempts, upstreamRetryBaseDelay, j)
+	upstreamRequestDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+func recordUpstreamFailure(provider string) {
+	upstreamFailuresTotal.WithLabelValues(provider).Inc()
+}
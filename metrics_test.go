@@ -0,0 +1,130 @@
+package main
+
+import (
+  "context"
+  "io"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+  "github.com/prometheus/client_golang/prometheus/testutil"
+  dto "github.com/prometheus/client_model/go"
+)
+
+func TestInstrumentHandlerCountsRequests(t *testing.T) {
+  counter := httpRequestsTotal.WithLabelValues("temperature", "422")
+  before := testutil.ToFloat64(counter)
+
+  handler := instrumentHandler("temperature", http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=1234567", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  handler.ServeHTTP(httptest.NewRecorder(), req)
+
+  if after := testutil.ToFloat64(counter); after != before+1 {
+    t.Errorf("Expected request counter to be %v, got %v", before+1, after)
+  }
+
+  // Scrape the metrics endpoint and check the series is exposed
+  server := httptest.NewServer(promhttp.Handler())
+  defer server.Close()
+
+  resp, err := http.Get(server.URL)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer resp.Body.Close()
+
+  body, err := io.ReadAll(resp.Body)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for _, expected := range []string{
+    `cep_temp_http_requests_total{code="422",handler="temperature"}`,
+    `cep_temp_http_request_duration_seconds_count{handler="temperature"}`,
+  } {
+    if !strings.Contains(string(body), expected) {
+      t.Errorf("Expected /metrics to contain %s", expected)
+    }
+  }
+}
+
+func TestUpstreamFailuresAreCounted(t *testing.T) {
+  counter := upstreamFailuresTotal.WithLabelValues(providerWeatherAPI)
+  before := testutil.ToFloat64(counter)
+
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusBadRequest, `{}`), nil
+  })
+
+  if _, err := NewServer(testConfig(), mockClient).getTemperatureFromLocation(context.Background(), "Recife", ""); err == nil {
+    t.Fatal("Expected error, got nil")
+  }
+
+  if after := testutil.ToFloat64(counter); after != before+1 {
+    t.Errorf("Expected upstream failure counter to be %v, got %v", before+1, after)
+  }
+}
+
+func TestUpstreamLatencyIsRecorded(t *testing.T) {
+  const delay = 20 * time.Millisecond
+  slowClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    time.Sleep(delay)
+    if strings.Contains(req.URL.String(), "viacep.com.br") {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  })
+  s := NewServer(testConfig(), slowClient)
+
+  tests := []struct {
+    provider string
+    call     func() error
+  }{
+    {providerViaCEP, func() error {
+      _, err := s.getLocationFromCEP(context.Background(), "01001000")
+      return err
+    }},
+    {providerWeatherAPI, func() error {
+      _, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", "")
+      return err
+    }},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.provider, func(t *testing.T) {
+      countBefore, sumBefore := upstreamLatency(t, tt.provider)
+
+      if err := tt.call(); err != nil {
+        t.Fatalf("Expected no error, got %v", err)
+      }
+
+      count, sum := upstreamLatency(t, tt.provider)
+      if count != countBefore+1 {
+        t.Errorf("Expected %d observations, got %d", countBefore+1, count)
+      }
+      if recorded := sum - sumBefore; recorded < delay.Seconds() {
+        t.Errorf("Expected at least %v recorded, got %vs", delay, recorded)
+      }
+    })
+  }
+}
+
+// upstreamLatency returns the observation count and sum of the upstream
+// latency histogram for provider.
+func upstreamLatency(t *testing.T, provider string) (uint64, float64) {
+  t.Helper()
+
+  var metric dto.Metric
+  if err := upstreamRequestDuration.WithLabelValues(provider).(prometheus.Histogram).Write(&metric); err != nil {
+    t.Fatal(err)
+  }
+  return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRequestTimeout = 20 * time.Second
+
+// Middleware wraps a handler with behaviour shared across routes.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h with mw, the first middleware outermost: it sees the request
+// first and the response last.
+func chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// withTimeout adapts timeoutMiddleware to a Middleware.
+func withTimeout(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return timeoutMiddleware(timeout, next)
+	}
+}
+
+// responseTimeHeader reports how long the server took to start answering,
+// in milliseconds.
+const responseTimeHeader = "X-Response-Time"
+
+// responseTimeMiddleware sets responseTimeHeader when next writes the
+// status line. It sits outside gzipMiddleware and timeoutMiddleware, which
+// hold the response back until they are done, so the time covers their
+// work too.
+func responseTimeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&responseTimeWriter{ResponseWriter: w, start: time.Now()}, r)
+	})
+}
+
+type responseTimeWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	wroteHeader bool
+}
+
+func (rw *responseTimeWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		elapsed := float64(time.Since(rw.start)) / float64(time.Millisecond)
+		rw.Header().Set(responseTimeHeader, strconv.FormatFloat(elapsed, 'f', 3, 64))
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseTimeWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// recoverMiddleware turns a panic in next into a JSON 500 instead of a
+// dropped connection. The panic is logged with the request ID the handler
+// assigned, or a fresh one if it panicked before doing so.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			requestID := w.Header().Get(requestIDHeader)
+			if requestID == "" {
+				requestID = newRequestID()
+				w.Header().Set(requestIDHeader, requestID)
+			}
+
+			logger.Error("handler panicked",
+				"request_id", requestID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+			responseWithError(w, r, http.StatusInternalServerError, msgInternalError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeoutMiddleware bounds how long next may take to respond. next runs with
+// a context that expires after timeout and writes into a buffer; if it
+// hasn't finished by then the client gets a JSON 504 and anything next
+// writes afterwards is discarded. Unlike http.TimeoutHandler, which answers
+// 503, this reports the timeout as a gateway timeout.
+func timeoutMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					panicked <- recovered
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case recovered := <-panicked:
+			panic(recovered)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			for key, values := range tw.header {
+				// Outer middleware such as gzipMiddleware may already have
+				// set Vary; keep its values alongside next's.
+				if key == "Vary" {
+					w.Header()[key] = append(w.Header()[key], values...)
+					continue
+				}
+				w.Header()[key] = values
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+
+			logger.Warn("request timed out",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"timeout", timeout.String(),
+			)
+			responseWithError(w, r, http.StatusGatewayTimeout, msgTimedOut)
+		}
+	})
+}
+
+// timeoutWriter buffers a response until timeoutMiddleware decides whether
+// to send it. Its header map belongs to the handler goroutine and is only
+// read once the handler has returned.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
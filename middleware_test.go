@@ -0,0 +1,244 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "log/slog"
+  "net/http"
+  "net/http/httptest"
+  "strconv"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestChain(t *testing.T) {
+  var calls []string
+  trace := func(name string) Middleware {
+    return func(next http.Handler) http.Handler {
+      return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls = append(calls, name+" before")
+        next.ServeHTTP(w, r)
+        calls = append(calls, name+" after")
+      })
+    }
+  }
+
+  handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    calls = append(calls, "handler")
+  }), trace("outer"), trace("inner"))
+
+  handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+  expected := "outer before,inner before,handler,inner after,outer after"
+  if got := strings.Join(calls, ","); got != expected {
+    t.Errorf("Expected calls %s, got %s", expected, got)
+  }
+}
+
+func TestChainWithoutMiddleware(t *testing.T) {
+  handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.WriteHeader(http.StatusTeapot)
+  }))
+
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+  if rr.Code != http.StatusTeapot {
+    t.Errorf("Expected the handler to run unwrapped, got status %d", rr.Code)
+  }
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+  // Capture log output and restore the original logger after test
+  originalLogger := logger
+  defer func() { logger = originalLogger }()
+
+  var buf bytes.Buffer
+  logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+  handler := recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set(requestIDHeader, "test-request-id")
+    var response *TemperatureResponse
+    _ = response.City
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusInternalServerError {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+  }
+
+  if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+    t.Errorf("Expected Content-Type application/json, got %q", contentType)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.Message != "erro interno do servidor" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "erro interno do servidor")
+  }
+
+  var entry map[string]interface{}
+  if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+    t.Fatalf("Failed to parse log line %q: %v", buf.String(), err)
+  }
+
+  if entry["msg"] != "handler panicked" || entry["request_id"] != "test-request-id" {
+    t.Errorf("Expected panic to be logged with the request ID, got %v", entry)
+  }
+
+  if panicValue, _ := entry["panic"].(string); !strings.Contains(panicValue, "nil pointer dereference") {
+    t.Errorf("Expected the panic value to be logged, got %v", entry["panic"])
+  }
+}
+
+func TestRecoverMiddlewareAssignsRequestID(t *testing.T) {
+  // Silence log output and restore the original logger after test
+  originalLogger := logger
+  defer func() { logger = originalLogger }()
+
+  var buf bytes.Buffer
+  logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+  handler := recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    panic("boom")
+  }))
+
+  req, err := http.NewRequest("GET", "/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusInternalServerError {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+  }
+
+  if rr.Header().Get(requestIDHeader) == "" {
+    t.Error("Expected a request ID header on the recovered response")
+  }
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+  handler := timeoutMiddleware(time.Second, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain")
+    w.WriteHeader(http.StatusTeapot)
+    w.Write([]byte("short and stout"))
+  }))
+
+  req, err := http.NewRequest("GET", "/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusTeapot {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusTeapot)
+  }
+
+  if contentType := rr.Header().Get("Content-Type"); contentType != "text/plain" {
+    t.Errorf("Expected Content-Type text/plain, got %q", contentType)
+  }
+
+  if body := rr.Body.String(); body != "short and stout" {
+    t.Errorf("handler returned unexpected body: got %q", body)
+  }
+}
+
+func TestTimeoutMiddlewareSlowUpstream(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() { upstreamRetryBaseDelay = originalDelay }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  // Simulate a hung upstream that only gives up when the request is cancelled
+  slowClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    <-req.Context().Done()
+    return nil, req.Context().Err()
+  })
+
+  finished := make(chan struct{})
+  handler := timeoutMiddleware(50*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    defer close(finished)
+    if _, err := NewServer(testConfig(), slowClient).getLocationFromCEP(r.Context(), "01001000"); err != nil {
+      responseWithError(w, r, http.StatusNotFound, "can not find zipcode")
+    }
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  start := time.Now()
+  rr := httptest.NewRecorder()
+  handler.ServeHTTP(rr, req)
+  <-finished
+
+  if elapsed := time.Since(start); elapsed > time.Second {
+    t.Errorf("Expected the request to time out after 50ms, took %v", elapsed)
+  }
+
+  if status := rr.Code; status != http.StatusGatewayTimeout {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusGatewayTimeout)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.Message != "tempo limite da requisição esgotado" {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, "tempo limite da requisição esgotado")
+  }
+}
+
+func TestResponseTimeMiddleware(t *testing.T) {
+  body := strings.Repeat("temperature ", 200)
+  handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    time.Sleep(5 * time.Millisecond)
+    w.Write([]byte(body))
+  })
+
+  tests := []struct {
+    name    string
+    handler http.Handler
+  }{
+    {"Plain", responseTimeMiddleware(handler)},
+    {"With gzip and timeout", chain(handler, responseTimeMiddleware, gzipMiddleware, withTimeout(time.Second))},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest("GET", "/", nil)
+      req.Header.Set("Accept-Encoding", "gzip")
+      rr := httptest.NewRecorder()
+      tt.handler.ServeHTTP(rr, req)
+
+      value := rr.Header().Get(responseTimeHeader)
+      if value == "" {
+        t.Fatalf("Expected an %s header", responseTimeHeader)
+      }
+      ms, err := strconv.ParseFloat(value, 64)
+      if err != nil {
+        t.Fatalf("Expected %s to be a number, got %q", responseTimeHeader, value)
+      }
+      if ms < 5 {
+        t.Errorf("Expected %s to cover the handler's 5ms, got %v", responseTimeHeader, ms)
+      }
+    })
+  }
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// mockTempC and mockCity make up the canned reading served for ?mock=true.
+const (
+	mockTempC = 20.0
+	mockCity  = "Mock City"
+)
+
+// mockTemperatureResponse returns the canned reading, converted like a real
+// one so every unit is present.
+func (s *Server) mockTemperatureResponse(ctx context.Context) *TemperatureResponse {
+	var weather WeatherAPIResponse
+	weather.Current.TempC = mockTempC
+	response := s.newTemperatureResponse(ctx, &weather, mockCity)
+	response.Conditions = nil
+	response.units = s.defaultUnits()
+	return response
+}
+
+// serveMockTemperature answers with the canned reading when mocking is
+// allowed by ALLOW_MOCK and the request asks for it with mock=true. It
+// reports whether it wrote the response; otherwise the parameter is ignored.
+func (s *Server) serveMockTemperature(w http.ResponseWriter, r *http.Request) bool {
+	if !s.config.AllowMock {
+		return false
+	}
+	if mock, err := parseBoolParam(r.URL.Query().Get("mock")); err != nil || !mock {
+		return false
+	}
+
+	// Smoke-test answers must never be mistaken for cached real data
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.mockTemperatureResponse(r.Context()))
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestTemperatureHandlerMock(t *testing.T) {
+  cfg := testConfig()
+  cfg.AllowMock = true
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    t.Errorf("Expected no upstream call in mock mode, got %s", req.URL)
+    return mockResponse(http.StatusInternalServerError, `{}`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?mock=true", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+    t.Errorf("Expected Cache-Control no-store, got %q", cc)
+  }
+
+  var response TemperatureResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  if response.TempC != 20.0 || response.TempF != 68.0 || response.TempK != 293.15 || response.City != "Mock City" {
+    t.Errorf("Expected the canned 20 C reading, got %s", rr.Body.String())
+  }
+}
+
+func TestTemperatureHandlerMockDisabled(t *testing.T) {
+  // ALLOW_MOCK is off by default, so mock=true is ignored and the usual
+  // parameter validation applies
+  s := NewServer(testConfig(), nil)
+
+  req, err := http.NewRequest("GET", "/temperature?mock=true", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusBadRequest {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+  }
+}
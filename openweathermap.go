@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultOpenWeatherMapBaseURL = "https://api.openweathermap.org/data/2.5"
+
+// ErrWeatherLocationNotFound means a secondary weather provider doesn't know
+// the city. WeatherAPI reports the same case as error code 1006.
+var ErrWeatherLocationNotFound = errors.New("weather location not found")
+
+// WeatherProvider reports the current temperature for a city. A Server asks
+// its providers in turn; see newWeatherProviders.
+type WeatherProvider interface {
+	CurrentTempC(ctx context.Context, city string) (float64, error)
+}
+
+// weatherReporter is implemented by providers that also report the
+// conditions around the temperature, as WeatherAPI does. lookupWeather
+// prefers it to CurrentTempC.
+type weatherReporter interface {
+	// currentWeather returns city's reading with the condition text in
+	// lang, and whether it was served from the provider's cache.
+	currentWeather(ctx context.Context, city, lang string) (*WeatherAPIResponse, bool, error)
+}
+
+// weatherAPIProvider is WeatherAPI, the primary provider, behind the weather
+// cache and the circuit breaker.
+type weatherAPIProvider struct {
+	server *Server
+}
+
+func (p weatherAPIProvider) CurrentTempC(ctx context.Context, city string) (float64, error) {
+	weather, _, err := p.currentWeather(ctx, city, "")
+	if err != nil {
+		return 0, err
+	}
+	return weather.Current.TempC, nil
+}
+
+func (p weatherAPIProvider) currentWeather(ctx context.Context, city, lang string) (*WeatherAPIResponse, bool, error) {
+	fetch := func(ctx context.Context) (*WeatherAPIResponse, error) {
+		var weather *WeatherAPIResponse
+		err := p.server.weatherBreaker.call(ctx, func() error {
+			var err error
+			weather, err = p.server.getTemperatureFromLocation(ctx, city, lang)
+			return err
+		})
+		return weather, err
+	}
+
+	key := weatherCacheKey(city, lang)
+	if airQualityRequested(ctx) {
+		key += "|aqi"
+	}
+	key += weatherPassthroughCacheKey(ctx)
+
+	if cacheBypassed(ctx) {
+		weather, err := p.server.cityWeatherCache.refresh(ctx, key, fetch)
+		return weather, false, err
+	}
+	return p.server.cityWeatherCache.get(ctx, key, fetch)
+}
+
+// openWeatherMapProvider queries OpenWeatherMap's current weather endpoint.
+type openWeatherMapProvider struct {
+	apiKey       string
+	baseURL      string
+	userAgent    string
+	maxBodyBytes int64
+	client       HTTPClient
+	slots        *upstreamLimiter
+	retryJitter  *jitter
+}
+
+type OpenWeatherMapResponse struct {
+	Name string `json:"name"`
+	Main *struct {
+		Temp float64 `json:"temp"`
+	} `json:"main"`
+}
+
+func (p openWeatherMapProvider) CurrentTempC(ctx context.Context, city string) (tempC float64, err error) {
+	ctx, span := startSpan(ctx, "openweathermap.current", attribute.String("city", city))
+	defer func() { endSpan(span, err) }()
+
+	query := url.Values{}
+	query.Set("q", city)
+	query.Set("units", "metric")
+	query.Set("appid", p.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/weather?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	prepareUpstreamRequest(ctx, req, p.userAgent)
+
+	release, err := p.slots.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	resp, err := doUpstream(providerOpenWeatherMap, p.client, p.retryJitter, req)
+	if err != nil {
+		recordUpstreamFailure(providerOpenWeatherMap)
+		return 0, &UpstreamError{Provider: providerOpenWeatherMap, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, ErrWeatherLocationNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		recordUpstreamFailure(providerOpenWeatherMap)
+		return 0, &UpstreamError{Provider: providerOpenWeatherMap, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+
+	data, err := readUpstreamBody(resp.Body, p.maxBodyBytes)
+	if err != nil {
+		recordUpstreamFailure(providerOpenWeatherMap)
+		return 0, &UpstreamError{Provider: providerOpenWeatherMap, Err: err}
+	}
+
+	var weather OpenWeatherMapResponse
+	if err := json.Unmarshal(data, &weather); err != nil {
+		recordUpstreamFailure(providerOpenWeatherMap)
+		return 0, &UpstreamError{Provider: providerOpenWeatherMap, Err: invalidBodyError(fmt.Sprintf("city %q", city), err)}
+	}
+	if weather.Main == nil {
+		recordUpstreamFailure(providerOpenWeatherMap)
+		return 0, &UpstreamError{Provider: providerOpenWeatherMap, Err: errors.New("response has no main.temp")}
+	}
+
+	return weather.Main.Temp, nil
+}
+
+// newWeatherProviders lists, in the order they are asked, the providers s
+// reports the weather from: WeatherAPI, then OpenWeatherMap once
+// OPENWEATHERMAP_API_KEY is set.
+func newWeatherProviders(s *Server) []WeatherProvider {
+	providers := []WeatherProvider{weatherAPIProvider{server: s}}
+	if s.config.OpenWeatherMapAPIKey != "" {
+		providers = append(providers, openWeatherMapProvider{
+			apiKey:       s.config.OpenWeatherMapAPIKey,
+			baseURL:      s.config.OpenWeatherMapBaseURL,
+			userAgent:    s.config.UserAgent,
+			maxBodyBytes: s.config.MaxUpstreamBodyBytes,
+			client:       s.client,
+			slots:        s.upstreamSlots,
+			retryJitter:  s.retryJitter,
+		})
+	}
+	return providers
+}
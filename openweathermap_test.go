@@ -0,0 +1,195 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+const mockOpenWeatherMapBody = `{"name": "São Paulo", "main": {"temp": 18.5}}`
+
+func TestOpenWeatherMapCurrentTempC(t *testing.T) {
+  tests := []struct {
+    name     string
+    status   int
+    body     string
+    expected float64
+    err      error
+  }{
+    {"Success", http.StatusOK, mockOpenWeatherMapBody, 18.5, nil},
+    {"Unknown city", http.StatusNotFound, `{"cod": "404", "message": "city not found"}`, 0, ErrWeatherLocationNotFound},
+    {"Missing temperature", http.StatusOK, `{"name": "São Paulo"}`, 0, ErrWeatherUnavailable},
+    {"Bad key", http.StatusUnauthorized, `{"cod": 401}`, 0, ErrWeatherUnavailable},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      var query string
+      provider := openWeatherMapProvider{
+        apiKey:       "owm-key",
+        baseURL:      defaultOpenWeatherMapBaseURL,
+        maxBodyBytes: defaultMaxUpstreamBodyBytes,
+        slots:        newUpstreamLimiter(0, 0),
+        retryJitter:  newRetryJitter(),
+        client: setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+          query = req.URL.RawQuery
+          return mockResponse(tt.status, tt.body), nil
+        }),
+      }
+
+      tempC, err := provider.CurrentTempC(context.Background(), "São Paulo")
+      if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+        t.Fatalf("Expected error %v, got %v", tt.err, err)
+      }
+      if tempC != tt.expected {
+        t.Errorf("Expected %v, got %v", tt.expected, tempC)
+      }
+      if expected := "appid=owm-key&q=S%C3%A3o+Paulo&units=metric"; query != expected {
+        t.Errorf("Expected query %q, got %q", expected, query)
+      }
+    })
+  }
+}
+
+func TestNewWeatherProviders(t *testing.T) {
+  cfg := testConfig()
+  if providers := NewServer(cfg, nil).weatherProviders; len(providers) != 1 {
+    t.Fatalf("Expected only WeatherAPI without an OpenWeatherMap key, got %d providers", len(providers))
+  }
+
+  cfg.OpenWeatherMapAPIKey = "owm-key"
+  providers := NewServer(cfg, nil).weatherProviders
+  if len(providers) != 2 {
+    t.Fatalf("Expected 2 providers, got %d", len(providers))
+  }
+  if _, ok := providers[0].(weatherAPIProvider); !ok {
+    t.Errorf("Expected WeatherAPI first, got %T", providers[0])
+  }
+  if _, ok := providers[1].(openWeatherMapProvider); !ok {
+    t.Errorf("Expected OpenWeatherMap second, got %T", providers[1])
+  }
+}
+
+func TestWeatherProvidersCurrentTempC(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  cfg := testConfig()
+  cfg.OpenWeatherMapAPIKey = "owm-key"
+  providers := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "api.openweathermap.org" {
+      return mockResponse(http.StatusOK, mockOpenWeatherMapBody), nil
+    }
+    return mockResponse(http.StatusInternalServerError, `{}`), nil
+  })).weatherProviders
+
+  if _, err := providers[0].CurrentTempC(context.Background(), "São Paulo"); !errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected WeatherAPI to fail with ErrWeatherUnavailable, got %v", err)
+  }
+
+  tempC, err := providers[1].CurrentTempC(context.Background(), "São Paulo")
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+  if tempC != 18.5 {
+    t.Errorf("Expected OpenWeatherMap's 18.5, got %v", tempC)
+  }
+}
+
+func TestTemperatureHandlerFallsBackToOpenWeatherMap(t *testing.T) {
+  originalDelay := upstreamRetryBaseDelay
+  defer func() {
+    upstreamRetryBaseDelay = originalDelay
+  }()
+  upstreamRetryBaseDelay = time.Millisecond
+
+  tests := []struct {
+    name     string
+    owmKey   string
+    expected int
+  }{
+    {"Fallback configured", "owm-key", http.StatusOK},
+    {"No fallback", "", http.StatusBadGateway},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := testConfig()
+      cfg.OpenWeatherMapAPIKey = tt.owmKey
+      s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        switch req.URL.Host {
+        case "viacep.com.br":
+          return mockResponse(http.StatusOK, mockViaCEPBody), nil
+        case "api.openweathermap.org":
+          return mockResponse(http.StatusOK, mockOpenWeatherMapBody), nil
+        }
+        return mockResponse(http.StatusInternalServerError, `{}`), nil
+      }))
+
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000&extended=true", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expected {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expected)
+      }
+      if tt.expected != http.StatusOK {
+        return
+      }
+
+      var response map[string]interface{}
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+      if response["temp_C"] != 18.5 {
+        t.Errorf("Expected temp_C 18.5 from OpenWeatherMap, got %v", response["temp_C"])
+      }
+      if _, ok := response["conditions"]; ok {
+        t.Errorf("Expected no conditions from the fallback provider, got %v", response["conditions"])
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerNotFoundSkipsOpenWeatherMap(t *testing.T) {
+  cfg := testConfig()
+  cfg.OpenWeatherMapAPIKey = "owm-key"
+
+  owmCalled := false
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    switch req.URL.Host {
+    case "viacep.com.br":
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    case "api.openweathermap.org":
+      owmCalled = true
+      return mockResponse(http.StatusOK, mockOpenWeatherMapBody), nil
+    }
+    return mockResponse(http.StatusBadRequest, `{"error": {"code": 1006, "message": "No matching location found."}}`), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusNotFound {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+  }
+  if owmCalled {
+    t.Error("Expected OpenWeatherMap not to be asked for a location WeatherAPI doesn't know")
+  }
+}
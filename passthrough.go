@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/url"
+)
+
+// reservedWeatherParams are the WeatherAPI parameters the service sets
+// itself, so they can't be allowlisted: the key, the city and the aqi and
+// lang the /temperature query already validates.
+var reservedWeatherParams = map[string]bool{
+	"key":  true,
+	"q":    true,
+	"aqi":  true,
+	"lang": true,
+}
+
+// passthroughParams returns the parameters of query named in
+// WEATHER_API_PASSTHROUGH_PARAMS, to be forwarded to WeatherAPI as they
+// are. Everything else is dropped.
+func (s *Server) passthroughParams(query url.Values) url.Values {
+	params := url.Values{}
+	for _, name := range s.config.WeatherAPIParams {
+		if values, ok := query[name]; ok {
+			params[name] = values
+		}
+	}
+	return params
+}
+
+type weatherPassthroughKey struct{}
+
+// withWeatherPassthrough attaches params to ctx so WeatherAPI lookups add
+// them to the upstream query; see applyWeatherPassthrough.
+func withWeatherPassthrough(ctx context.Context, params url.Values) context.Context {
+	return context.WithValue(ctx, weatherPassthroughKey{}, params)
+}
+
+func weatherPassthrough(ctx context.Context) url.Values {
+	params, _ := ctx.Value(weatherPassthroughKey{}).(url.Values)
+	return params
+}
+
+// applyWeatherPassthrough adds the parameters carried by ctx to query,
+// skipping reserved ones.
+func applyWeatherPassthrough(ctx context.Context, query url.Values) {
+	for name, values := range weatherPassthrough(ctx) {
+		if reservedWeatherParams[name] {
+			continue
+		}
+		query[name] = values
+	}
+}
+
+// weatherPassthroughCacheKey distinguishes cached readings fetched with
+// different passthrough parameters. It is empty when there are none.
+func weatherPassthroughCacheKey(ctx context.Context) string {
+	params := weatherPassthrough(ctx)
+	if len(params) == 0 {
+		return ""
+	}
+	return "|" + params.Encode()
+}
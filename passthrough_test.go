@@ -0,0 +1,77 @@
+package main
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "testing"
+)
+
+func TestTemperatureHandlerWeatherAPIPassthrough(t *testing.T) {
+  cfg := testConfig()
+  cfg.WeatherAPIParams = []string{"alerts"}
+
+  var weatherQuery url.Values
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    weatherQuery = req.URL.Query()
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  req := httptest.NewRequest("GET", "/temperature?cep=01001000&alerts=yes&tides=yes&aqi=false", nil)
+  rr := httptest.NewRecorder()
+  s.temperatureHandler(rr, req)
+
+  if rr.Code != http.StatusOK {
+    t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+  }
+
+  if got := weatherQuery.Get("alerts"); got != "yes" {
+    t.Errorf("Expected the allowlisted alerts parameter to be forwarded, got %q", got)
+  }
+  if weatherQuery.Has("tides") {
+    t.Errorf("Expected the disallowed tides parameter to be dropped, got %v", weatherQuery)
+  }
+  if got := weatherQuery["aqi"]; len(got) != 1 || got[0] != "no" {
+    t.Errorf("Expected the service's aqi=no, got %v", got)
+  }
+}
+
+func TestTemperatureHandlerWeatherAPIPassthroughDisabled(t *testing.T) {
+  var weatherQuery url.Values
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    weatherQuery = req.URL.Query()
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  req := httptest.NewRequest("GET", "/temperature?cep=01001000&alerts=yes", nil)
+  rr := httptest.NewRecorder()
+  s.temperatureHandler(rr, req)
+
+  if rr.Code != http.StatusOK {
+    t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+  }
+  if weatherQuery.Has("alerts") {
+    t.Errorf("Expected no parameter to be forwarded without an allowlist, got %v", weatherQuery)
+  }
+}
+
+func TestApplyWeatherPassthroughSkipsReserved(t *testing.T) {
+  ctx := withWeatherPassthrough(context.Background(), url.Values{"key": {"stolen"}, "q": {"elsewhere"}, "aqi": {"yes"}, "lang": {"xx"}, "tp": {"15"}})
+
+  query := url.Values{}
+  query.Set("q", "São Paulo")
+  query.Set("aqi", "no")
+  applyWeatherPassthrough(ctx, query)
+
+  expected := url.Values{"q": {"São Paulo"}, "aqi": {"no"}, "tp": {"15"}}
+  if query.Encode() != expected.Encode() {
+    t.Errorf("Expected %v, got %v", expected, query)
+  }
+}
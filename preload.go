@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// preloadTimeout bounds the startup preload, so an unreachable ViaCEP can't
+// hold readiness back for long.
+const preloadTimeout = 30 * time.Second
+
+// readCEPList parses a newline-delimited CEP list. Blank lines and lines
+// starting with # are skipped, CEPs are normalized like the cep query
+// parameter, and invalid ones are logged and dropped.
+func readCEPList(r io.Reader) ([]string, error) {
+	var ceps []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+
+		cep := normalizeCEP(value)
+		if err := validateCEP(cep); err != nil {
+			logger.Warn("skipping invalid CEP in preload list", "line", line, "cep", value, "error", err.Error())
+			continue
+		}
+		if seen[cep] {
+			continue
+		}
+		seen[cep] = true
+		ceps = append(ceps, cep)
+	}
+
+	return ceps, scanner.Err()
+}
+
+// preloadLocations resolves each CEP into s.cepLocationCache so the first
+// request for it doesn't wait on ViaCEP. It is best-effort: failures are
+// logged and skipped. It returns how many CEPs were cached.
+func (s *Server) preloadLocations(ctx context.Context, ceps []string) int {
+	loaded := 0
+	for _, cep := range ceps {
+		if ctx.Err() != nil {
+			break
+		}
+
+		location, err := s.getLocationWithFallback(ctx, cep)
+		if err != nil {
+			logger.Warn("failed to preload CEP", "cep", cep, "error", err.Error())
+			continue
+		}
+		s.cepLocationCache.store(cep, location)
+		loaded++
+	}
+	return loaded
+}
+
+// preloadLocationsFromFile reads the CEP list at path and preloads it; see
+// preloadLocations.
+func (s *Server) preloadLocationsFromFile(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ceps, err := readCEPList(file)
+	if err != nil {
+		return err
+	}
+
+	loaded := s.preloadLocations(ctx, ceps)
+	logger.Info("preloaded CEPs", "file", path, "loaded", loaded, "total", len(ceps))
+	return nil
+}
+
+// startPreload preloads the CEP list at path in the background, bounded by
+// preloadTimeout, so the server can start listening meanwhile. Readiness is
+// held back until it is done; see readinessHandler.
+func (s *Server) startPreload(ctx context.Context, path string) {
+	s.preloadPending.Store(true)
+	go func() {
+		defer s.preloadPending.Store(false)
+
+		ctx, cancel := context.WithTimeout(ctx, preloadTimeout)
+		defer cancel()
+		if err := s.preloadLocationsFromFile(ctx, path); err != nil {
+			logger.Warn("failed to preload CEPs", "file", path, "error", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestReadCEPList(t *testing.T) {
+  input := strings.Join([]string{
+    "# capitals",
+    "01001000",
+    "",
+    "  20040-002  ",
+    "1234",
+    "abcdefgh",
+    "01001-000",
+    "70040010",
+  }, "\n")
+
+  ceps, err := readCEPList(strings.NewReader(input))
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  expected := []string{"01001000", "20040002", "70040010"}
+  if !reflect.DeepEqual(ceps, expected) {
+    t.Errorf("Expected %v, got %v", expected, ceps)
+  }
+}
+
+func TestPreloadLocations(t *testing.T) {
+  cfg := testConfig()
+  cfg.LocationCacheTTL = time.Hour
+
+  calls := map[string]int{}
+  client := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls[req.URL.Path]++
+    if strings.Contains(req.URL.Path, "99999999") {
+      return mockResponse(http.StatusOK, `{"erro": true}`), nil
+    }
+    return mockResponse(http.StatusOK, mockViaCEPBody), nil
+  })
+  s := NewServer(cfg, client)
+
+  loaded := s.preloadLocations(context.Background(), []string{"01001000", "99999999"})
+  if loaded != 1 {
+    t.Errorf("Expected 1 preloaded CEP, got %d", loaded)
+  }
+
+  location, ok := s.cepLocationCache.lookup("01001000")
+  if !ok {
+    t.Fatal("Expected 01001000 to be cached")
+  }
+  if location.Localidade != "São Paulo" {
+    t.Errorf("Expected São Paulo, got %q", location.Localidade)
+  }
+  if _, ok := s.cepLocationCache.lookup("99999999"); ok {
+    t.Error("Expected the unknown CEP not to be cached")
+  }
+}
+
+func TestPreloadLocationsFromFile(t *testing.T) {
+  cfg := testConfig()
+  cfg.LocationCacheTTL = time.Hour
+
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    return mockResponse(http.StatusOK, mockViaCEPBody), nil
+  }))
+
+  path := filepath.Join(t.TempDir(), "ceps.txt")
+  if err := os.WriteFile(path, []byte("01001000\n01001-001\n"), 0o600); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := s.preloadLocationsFromFile(context.Background(), path); err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+  for _, cep := range []string{"01001000", "01001001"} {
+    if _, ok := s.cepLocationCache.lookup(cep); !ok {
+      t.Errorf("Expected %s to be cached", cep)
+    }
+  }
+
+  if err := s.preloadLocationsFromFile(context.Background(), filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+    t.Error("Expected an error for a missing file")
+  }
+}
+
+func TestTemperatureHandlerUsesPreloadedLocation(t *testing.T) {
+  cfg := testConfig()
+  cfg.LocationCacheTTL = time.Hour
+
+  s := NewServer(cfg, setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.URL.Host == "viacep.com.br" || req.URL.Host == "brasilapi.com.br" {
+      t.Errorf("Expected no CEP lookup for a preloaded CEP, got %s", req.URL)
+    }
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+  s.cepLocationCache.store("01001000", &ViaCEPResponse{Localidade: "São Paulo", UF: "SP"})
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+}
+
+func TestReadinessHandlerWaitsForPreload(t *testing.T) {
+  release := make(chan struct{})
+  client := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    if req.Method == http.MethodHead {
+      return mockResponse(http.StatusNotFound, ""), nil
+    }
+    <-release
+    return mockResponse(http.StatusOK, mockViaCEPBody), nil
+  })
+  s := NewServer(defaultConfig(), client)
+
+  path := filepath.Join(t.TempDir(), "ceps.txt")
+  if err := os.WriteFile(path, []byte("01001000\n"), 0o600); err != nil {
+    t.Fatal(err)
+  }
+
+  ready := func() int {
+    rr := httptest.NewRecorder()
+    http.HandlerFunc(s.readinessHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+    return rr.Code
+  }
+
+  s.startPreload(context.Background(), path)
+  if status := ready(); status != http.StatusServiceUnavailable {
+    t.Errorf("Expected status %d while preloading, got %d", http.StatusServiceUnavailable, status)
+  }
+
+  close(release)
+  deadline := time.Now().Add(2 * time.Second)
+  for s.preloadPending.Load() && time.Now().Before(deadline) {
+    time.Sleep(5 * time.Millisecond)
+  }
+
+  if status := ready(); status != http.StatusOK {
+    t.Errorf("Expected status %d after preloading, got %d", http.StatusOK, status)
+  }
+  if _, ok := s.cepLocationCache.lookup("01001000"); !ok {
+    t.Error("Expected 01001000 to be cached")
+  }
+}
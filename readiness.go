@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+// preloadDependency names the PRELOAD_CEPS_FILE preload in the readiness
+// report while it is still running.
+const preloadDependency = "cep_preload"
+
+type readinessDependency struct {
+	Name string
+	URL  string
+}
+
+func (s *Server) readinessDependencies() []readinessDependency {
+	return []readinessDependency{
+		{Name: providerViaCEP, URL: s.config.ViaCEPBaseURL + "/"},
+		{Name: providerWeatherAPI, URL: s.config.WeatherAPIBaseURL + "/"},
+	}
+}
+
+type DependencyStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// checkDependency sends a HEAD request to dep. Any response below 500 counts
+// as reachable, since the base URLs aren't real API routes.
+func (s *Server) checkDependency(ctx context.Context, dep readinessDependency) DependencyStatus {
+	status := DependencyStatus{Name: dep.Name, Status: "up"}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, dep.URL, nil)
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+		return status
+	}
+	req.Header.Set("User-Agent", s.config.UserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		status.Status = "down"
+		status.Error = http.StatusText(resp.StatusCode)
+	}
+
+	return status
+}
+
+// readinessHandler reports 503 unless every upstream dependency is reachable
+// and the startup preload is done. Unlike /health, it is meant for readiness
+// gating.
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	dependencies := s.readinessDependencies()
+	response := ReadinessResponse{
+		Status:       "ready",
+		Dependencies: make([]DependencyStatus, len(dependencies)),
+	}
+
+	var wg sync.WaitGroup
+	for i, dep := range dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response.Dependencies[i] = s.checkDependency(r.Context(), dep)
+		}()
+	}
+	wg.Wait()
+	if s.preloadPending.Load() {
+		response.Dependencies = append(response.Dependencies, DependencyStatus{Name: preloadDependency, Status: "loading"})
+	}
+
+	statusCode := http.StatusOK
+	for _, dep := range response.Dependencies {
+		if dep.Status != "up" {
+			response.Status = "unavailable"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
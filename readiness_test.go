@@ -0,0 +1,66 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestReadinessHandler(t *testing.T) {
+  tests := []struct {
+    name           string
+    weatherDown    bool
+    expectedStatus int
+    expectedBody   string
+  }{
+    {"All Up", false, http.StatusOK, "ready"},
+    {"WeatherAPI Down", true, http.StatusServiceUnavailable, "unavailable"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      s := NewServer(defaultConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        if req.Method != http.MethodHead {
+          t.Errorf("Expected a HEAD request, got %s", req.Method)
+        }
+        if tt.weatherDown && req.URL.Host == "api.weatherapi.com" {
+          return nil, errors.New("connection refused")
+        }
+        return mockResponse(http.StatusNotFound, ""), nil
+      }))
+
+      req, err := http.NewRequest("GET", "/ready", nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.readinessHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != tt.expectedStatus {
+        t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+      }
+
+      var response ReadinessResponse
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if response.Status != tt.expectedBody {
+        t.Errorf("Expected status %q, got %q", tt.expectedBody, response.Status)
+      }
+
+      for _, dep := range response.Dependencies {
+        expected := "up"
+        if tt.weatherDown && dep.Name == providerWeatherAPI {
+          expected = "down"
+        }
+        if dep.Status != expected {
+          t.Errorf("Expected %s to be %s, got %s", dep.Name, expected, dep.Status)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const upstreamRetryAttempts = 3
+
+// upstreamRetryBaseDelay is the wait before the first retry; each following
+// retry doubles it. It is a variable so tests can shorten it.
+var upstreamRetryBaseDelay = 200 * time.Millisecond
+
+// jitter draws randomized retry delays from a seeded source. It is safe for
+// concurrent use.
+type jitter struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newJitter(src rand.Source) *jitter {
+	return &jitter{rng: rand.New(src)}
+}
+
+// delay returns a random duration between 0 and ceiling, inclusive.
+func (j *jitter) delay(ceiling time.Duration) time.Duration {
+	if ceiling <= 0 {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return time.Duration(j.rng.Int64N(int64(ceiling) + 1))
+}
+
+// newRetryJitter returns a jitter seeded at random, so servers that failed
+// together don't retry together.
+func newRetryJitter() *jitter {
+	return newJitter(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// doWithRetry sends req up to attempts times, retrying on network errors and
+// 5xx responses with exponential backoff and full jitter: each wait is random
+// between zero and a cap that starts at baseDelay and doubles per retry,
+// drawn from j. 4xx responses are returned as is. When every attempt fails,
+// the last response or error is returned.
+func doWithRetry(client HTTPClient, req *http.Request, attempts int, baseDelay time.Duration, j *jitter) (*http.Response, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	ctx := req.Context()
+	delay := baseDelay
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+
+		if attempt == attempts || ctx.Err() != nil {
+			break
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(j.delay(delay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+
+	return resp, err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+  "errors"
+  "math/rand/v2"
+  "net/http"
+  "testing"
+  "time"
+)
+
+func TestDoWithRetrySucceedsAfterFailures(t *testing.T) {
+  calls := 0
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls++
+    switch calls {
+    case 1:
+      return nil, errors.New("connection reset by peer")
+    case 2:
+      return mockResponse(http.StatusServiceUnavailable, "unavailable"), nil
+    }
+    return mockResponse(http.StatusOK, "{}"), nil
+  })
+
+  req, err := http.NewRequest(http.MethodGet, "https://viacep.com.br/ws/01001000/json/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  resp, err := doWithRetry(mockClient, req, 3, time.Millisecond, newJitter(rand.NewPCG(1, 2)))
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if resp.StatusCode != http.StatusOK {
+    t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+  }
+
+  if calls != 3 {
+    t.Errorf("Expected 3 calls, got %d", calls)
+  }
+}
+
+func TestDoWithRetryDoesNotRetryClientErrors(t *testing.T) {
+  calls := 0
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls++
+    return mockResponse(http.StatusNotFound, "not found"), nil
+  })
+
+  req, err := http.NewRequest(http.MethodGet, "https://viacep.com.br/ws/01001000/json/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  resp, err := doWithRetry(mockClient, req, 3, time.Millisecond, newJitter(rand.NewPCG(1, 2)))
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if resp.StatusCode != http.StatusNotFound {
+    t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+  }
+
+  if calls != 1 {
+    t.Errorf("Expected a single call for a 4xx response, got %d", calls)
+  }
+}
+
+func TestDoWithRetryGivesUp(t *testing.T) {
+  calls := 0
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls++
+    return mockResponse(http.StatusBadGateway, "bad gateway"), nil
+  })
+
+  req, err := http.NewRequest(http.MethodGet, "https://viacep.com.br/ws/01001000/json/", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  resp, err := doWithRetry(mockClient, req, 3, time.Millisecond, newJitter(rand.NewPCG(1, 2)))
+  if err != nil {
+    t.Fatalf("Expected the last response to be returned, got error %v", err)
+  }
+
+  if resp.StatusCode != http.StatusBadGateway {
+    t.Errorf("Expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+  }
+
+  if calls != 3 {
+    t.Errorf("Expected 3 calls, got %d", calls)
+  }
+}
+
+func TestJitterDelayBounds(t *testing.T) {
+  j := newJitter(rand.NewPCG(1, 2))
+
+  ceiling := 200 * time.Millisecond
+  belowCeiling := false
+  for i := 0; i < 100; i++ {
+    delay := j.delay(ceiling)
+    if delay < 0 || delay > ceiling {
+      t.Fatalf("draw %d: delay %v outside [0, %v]", i, delay, ceiling)
+    }
+    if delay < ceiling {
+      belowCeiling = true
+    }
+    ceiling *= 2
+    if ceiling > 10*time.Second {
+      ceiling = 200 * time.Millisecond
+    }
+  }
+  if !belowCeiling {
+    t.Error("Expected jittered delays below the exponential cap")
+  }
+
+  if delay := j.delay(0); delay != 0 {
+    t.Errorf("Expected no delay for a zero cap, got %v", delay)
+  }
+}
+
+func TestJitterIsDeterministicForASeed(t *testing.T) {
+  first := newJitter(rand.NewPCG(42, 7))
+  second := newJitter(rand.NewPCG(42, 7))
+
+  for i := 0; i < 10; i++ {
+    a, b := first.delay(time.Second), second.delay(time.Second)
+    if a != b {
+      t.Fatalf("draw %d: expected the same delay for the same seed, got %v and %v", i, a, b)
+    }
+  }
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultShutdownTimeout = 15 * time.Second
+
+// Server holds what the handlers are configured with, the settings main
+// loads and the client for upstream calls, and the state built from them:
+// caches, the WeatherAPI breaker and the upstream limiter. Nothing is shared
+// between Servers, so tests build their own.
+type Server struct {
+	config Config
+	client HTTPClient
+	// units is temperatureUnits with kelvin following KELVIN_PRECISE.
+	units []temperatureUnit
+	// weatherProviders are asked in order for the current weather.
+	weatherProviders []WeatherProvider
+	// preloadPending is set while startPreload runs; /ready answers 503
+	// until it is done.
+	preloadPending atomic.Bool
+
+	// weatherBreaker guards calls to WeatherAPI; see newWeatherBreaker.
+	weatherBreaker *circuitBreaker
+	// upstreamSlots bounds the calls in flight across every upstream.
+	upstreamSlots *upstreamLimiter
+	// cityWeatherCache serves /temperature lookups and cepLocationCache
+	// CEP resolution, which PRELOAD_CEPS_FILE fills at startup.
+	cityWeatherCache *ttlCache[*WeatherAPIResponse]
+	cepLocationCache *ttlCache[*ViaCEPResponse]
+	// weatherKeyCursor picks the WeatherAPI key in use out of the
+	// configured ones. It only moves when the current key runs out of
+	// quota, so keys are spent one after the other.
+	weatherKeyCursor atomic.Uint64
+	// retryJitter spreads out upstream retries; see doWithRetry.
+	retryJitter *jitter
+}
+
+// NewServer builds a Server from cfg, with its own caches, breaker and
+// upstream limiter sized by cfg.
+func NewServer(cfg Config, client HTTPClient) *Server {
+	s := &Server{
+		config:           cfg,
+		client:           client,
+		units:            temperatureUnitsFor(cfg.KelvinPrecise),
+		weatherBreaker:   newWeatherBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		upstreamSlots:    newUpstreamLimiter(cfg.MaxUpstreamRequests, defaultUpstreamAcquireWait),
+		cityWeatherCache: newWeatherCache(cfg.WeatherCacheTTL),
+		cepLocationCache: newLocationCache(cfg.LocationCacheTTL),
+		retryJitter:      newRetryJitter(),
+	}
+	s.cityWeatherCache.fetchTimeout = cfg.RequestTimeout
+	s.cepLocationCache.fetchTimeout = cfg.RequestTimeout
+	s.weatherProviders = newWeatherProviders(s)
+	return s
+}
+
+// routes registers every endpoint under APIPrefix and wraps them with the
+// shared middleware.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	prefix := s.config.APIPrefix
+	route(mux, prefix+"/temperature", instrumentHandler("temperature", http.HandlerFunc(s.temperatureHandler)), http.MethodGet)
+	route(mux, prefix+"/temperature/batch", instrumentHandler("temperature_batch", http.HandlerFunc(s.batchTemperatureHandler)), http.MethodPost)
+	route(mux, prefix+"/temperature/coords", instrumentHandler("temperature_coords", http.HandlerFunc(s.coordsTemperatureHandler)), http.MethodGet)
+	route(mux, prefix+"/forecast", instrumentHandler("forecast", http.HandlerFunc(s.forecastHandler)), http.MethodGet)
+	route(mux, prefix+"/convert", instrumentHandler("convert", http.HandlerFunc(s.convertHandler)), http.MethodGet)
+	route(mux, prefix+"/units", instrumentHandler("units", http.HandlerFunc(s.unitsHandler)), http.MethodGet)
+	route(mux, prefix+"/metrics", promhttp.Handler(), http.MethodGet)
+	route(mux, prefix+"/health", http.HandlerFunc(healthCheckHandler), http.MethodGet)
+	route(mux, prefix+"/ready", http.HandlerFunc(s.readinessHandler), http.MethodGet)
+	route(mux, prefix+"/version", http.HandlerFunc(versionHandler), http.MethodGet)
+	route(mux, prefix+"/stats", http.HandlerFunc(s.statsHandler), http.MethodGet)
+	return chain(mux,
+		withErrorLanguages(s.config.ErrorLanguages),
+		responseTimeMiddleware,
+		recoverMiddleware,
+		gzipMiddleware,
+		withTimeout(s.config.RequestTimeout),
+	)
+}
+
+// route registers handler for path under each of methods, using ServeMux
+// method patterns, so handlers never see a method they don't serve. GET
+// also matches HEAD. Any other method gets a 405 in the usual error format
+// with an Allow header listing the accepted ones.
+func route(mux *http.ServeMux, path string, handler http.Handler, methods ...string) {
+	allowed := make([]string, 0, len(methods)+1)
+	for _, method := range methods {
+		mux.Handle(method+" "+path, handler)
+		allowed = append(allowed, method)
+		if method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+
+	allow := strings.Join(allowed, ", ")
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		responseWithError(w, r, http.StatusMethodNotAllowed, msgMethodNotAllowed)
+	})
+}
+
+// serve runs server until ctx is cancelled, then stops accepting connections
+// and waits up to drainTimeout for in-flight requests, and any cache fetches
+// they started, to complete.
+func serve(ctx context.Context, server *http.Server, drainTimeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down server", "timeout", drainTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := waitForCacheFetches(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logger.Info("server stopped")
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+func TestNewRouterRegistersHandlers(t *testing.T) {
+  server := httptest.NewServer(NewServer(defaultConfig(), nil).routes())
+  defer server.Close()
+
+  resp, err := http.Get(server.URL + "/health")
+  if err != nil {
+    t.Fatal(err)
+  }
+  resp.Body.Close()
+
+  if resp.StatusCode != http.StatusOK {
+    t.Errorf("Expected /health to return %d, got %d", http.StatusOK, resp.StatusCode)
+  }
+
+  // Shutdown drains and closes the started server without error
+  ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+  defer cancel()
+  if err := server.Config.Shutdown(ctx); err != nil {
+    t.Errorf("Expected Shutdown to return nil, got %v", err)
+  }
+}
+
+func TestNewRouterAPIPrefix(t *testing.T) {
+  cfg := testConfig()
+  cfg.APIPrefix = "/api/v1"
+  s := NewServer(cfg, nil)
+
+  server := httptest.NewServer(s.routes())
+  defer server.Close()
+
+  tests := []struct {
+    path           string
+    expectedStatus int
+  }{
+    {"/api/v1/health", http.StatusOK},
+    {"/api/v1/version", http.StatusOK},
+    {"/health", http.StatusNotFound},
+    {"/temperature?cep=01001000", http.StatusNotFound},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.path, func(t *testing.T) {
+      resp, err := http.Get(server.URL + tt.path)
+      if err != nil {
+        t.Fatal(err)
+      }
+      resp.Body.Close()
+
+      if resp.StatusCode != tt.expectedStatus {
+        t.Errorf("Expected %s to return %d, got %d", tt.path, tt.expectedStatus, resp.StatusCode)
+      }
+    })
+  }
+}
+
+func TestNewRouterMethodRouting(t *testing.T) {
+  s := NewServer(testConfig(), nil)
+  router := s.routes()
+
+  tests := []struct {
+    method         string
+    path           string
+    expectedStatus int
+    expectedAllow  string
+  }{
+    {"GET", "/units", http.StatusOK, ""},
+    {"HEAD", "/units", http.StatusOK, ""},
+    {"POST", "/units", http.StatusMethodNotAllowed, "GET, HEAD"},
+    {"POST", "/temperature", http.StatusMethodNotAllowed, "GET, HEAD"},
+    {"DELETE", "/forecast", http.StatusMethodNotAllowed, "GET, HEAD"},
+    {"PUT", "/convert", http.StatusMethodNotAllowed, "GET, HEAD"},
+    {"POST", "/temperature/coords", http.StatusMethodNotAllowed, "GET, HEAD"},
+    {"GET", "/temperature/batch", http.StatusMethodNotAllowed, "POST"},
+    {"POST", "/health", http.StatusMethodNotAllowed, "GET, HEAD"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+      req := httptest.NewRequest(tt.method, tt.path, nil)
+      rr := httptest.NewRecorder()
+      router.ServeHTTP(rr, req)
+
+      if rr.Code != tt.expectedStatus {
+        t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+      }
+      if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+        t.Errorf("Expected Allow header %q, got %q", tt.expectedAllow, allow)
+      }
+    })
+  }
+}
+
+func TestServeStopsOnContextCancel(t *testing.T) {
+  server := &http.Server{Addr: "127.0.0.1:0", Handler: NewServer(defaultConfig(), nil).routes()}
+
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan error, 1)
+  go func() {
+    done <- serve(ctx, server, time.Second)
+  }()
+
+  cancel()
+
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Errorf("Expected serve to return nil after shutdown, got %v", err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("serve did not return after the context was cancelled")
+  }
+}
+
+func TestServeWaitsForCacheFetches(t *testing.T) {
+  server := &http.Server{Addr: "127.0.0.1:0", Handler: NewServer(defaultConfig(), nil).routes()}
+  cache := newWeatherCache(time.Minute)
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    close(started)
+    <-release
+    weather := &WeatherAPIResponse{}
+    weather.Current.TempC = 25.0
+    return weather, nil
+  }
+
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan error, 1)
+  go func() {
+    done <- serve(ctx, server, 5*time.Second)
+  }()
+
+  go cache.get(context.Background(), "Recife", fetch)
+  <-started
+  cancel()
+
+  select {
+  case err := <-done:
+    t.Fatalf("Expected serve to wait for the in-flight fetch, returned %v", err)
+  case <-time.After(50 * time.Millisecond):
+  }
+  close(release)
+
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Errorf("Expected serve to return nil after shutdown, got %v", err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("serve did not return after the fetch completed")
+  }
+
+  if _, ok := cache.lookup("Recife"); !ok {
+    t.Error("Expected the fetch started before shutdown to populate the cache")
+  }
+}
+
+func TestServeDrainTimeoutBoundsCacheFetches(t *testing.T) {
+  server := &http.Server{Addr: "127.0.0.1:0", Handler: NewServer(defaultConfig(), nil).routes()}
+  cache := newWeatherCache(time.Minute)
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  defer close(release)
+  fetch := func(context.Context) (*WeatherAPIResponse, error) {
+    close(started)
+    <-release
+    return &WeatherAPIResponse{}, nil
+  }
+
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan error, 1)
+  go func() {
+    done <- serve(ctx, server, 50*time.Millisecond)
+  }()
+
+  go cache.get(context.Background(), "Natal", fetch)
+  <-started
+  cancel()
+
+  select {
+  case err := <-done:
+    if !errors.Is(err, context.DeadlineExceeded) {
+      t.Errorf("Expected %v once the drain timeout passes, got %v", context.DeadlineExceeded, err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("serve did not return after the drain timeout")
+  }
+}
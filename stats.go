@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CacheStats counts the lookups a cache has answered since startup. Entries
+// is a snapshot of how many it currently holds.
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type StatsResponse struct {
+	LocationCache CacheStats `json:"location_cache"`
+	WeatherCache  CacheStats `json:"weather_cache"`
+}
+
+// statsHandler serves /stats, the hit, miss and entry counts of s's location
+// and weather caches, for operators sizing the TTLs.
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(StatsResponse{
+		LocationCache: s.cepLocationCache.stats(),
+		WeatherCache:  s.cityWeatherCache.stats(),
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+func TestStatsHandlerCountsHitsAndMisses(t *testing.T) {
+  s := NewServer(defaultConfig(), nil)
+
+  fetchWeather := func(context.Context) (*WeatherAPIResponse, error) { return &WeatherAPIResponse{}, nil }
+  fetchLocation := func(context.Context) (*ViaCEPResponse, error) { return &ViaCEPResponse{}, nil }
+  for i := 0; i < 2; i++ {
+    if _, _, err := s.cityWeatherCache.get(context.Background(), "Curitiba", fetchWeather); err != nil {
+      t.Fatalf("Expected no error, got %v", err)
+    }
+    if _, _, err := s.cepLocationCache.get(context.Background(), "80010000", fetchLocation); err != nil {
+      t.Fatalf("Expected no error, got %v", err)
+    }
+  }
+
+  req := httptest.NewRequest("GET", "/stats", nil)
+  rr := httptest.NewRecorder()
+  s.routes().ServeHTTP(rr, req)
+
+  if rr.Code != http.StatusOK {
+    t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+  }
+
+  var response StatsResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  expected := CacheStats{Hits: 1, Misses: 1, Entries: 1}
+  if response.WeatherCache != expected {
+    t.Errorf("Expected weather cache stats %+v, got %+v", expected, response.WeatherCache)
+  }
+  if response.LocationCache != expected {
+    t.Errorf("Expected location cache stats %+v, got %+v", expected, response.LocationCache)
+  }
+}
+
+func TestWeatherCacheStatsConcurrent(t *testing.T) {
+  cache := newWeatherCache(time.Minute)
+  fetch := func(context.Context) (*WeatherAPIResponse, error) { return &WeatherAPIResponse{}, nil }
+
+  const callers = 50
+  done := make(chan struct{})
+  for i := 0; i < callers; i++ {
+    go func() {
+      defer func() { done <- struct{}{} }()
+      cache.get(context.Background(), "Belém", fetch)
+    }()
+  }
+  for i := 0; i < callers; i++ {
+    <-done
+  }
+
+  stats := cache.stats()
+  if stats.Hits+stats.Misses != callers {
+    t.Errorf("Expected %d lookups counted, got %d hits and %d misses", callers, stats.Hits, stats.Misses)
+  }
+}
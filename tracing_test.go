@@ -0,0 +1,79 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+
+  "go.opentelemetry.io/otel"
+  "go.opentelemetry.io/otel/propagation"
+  sdktrace "go.opentelemetry.io/otel/sdk/trace"
+  "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTemperatureHandlerTracing(t *testing.T) {
+  // Save original tracing globals and restore them after test
+  originalProvider := otel.GetTracerProvider()
+  originalPropagator := otel.GetTextMapPropagator()
+  defer func() {
+    otel.SetTracerProvider(originalProvider)
+    otel.SetTextMapPropagator(originalPropagator)
+  }()
+
+  recorder := tracetest.NewSpanRecorder()
+  otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+  otel.SetTextMapPropagator(propagation.TraceContext{})
+
+  var traceparents []string
+  s := NewServer(testConfig(), setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    traceparents = append(traceparents, req.Header.Get("traceparent"))
+    if req.URL.Host == "viacep.com.br" {
+      return mockResponse(http.StatusOK, mockViaCEPBody), nil
+    }
+    return mockResponse(http.StatusOK, mockWeatherBody), nil
+  }))
+
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  spans := recorder.Ended()
+  if len(spans) != 3 {
+    t.Fatalf("Expected 3 spans, got %d", len(spans))
+  }
+
+  names := map[string]sdktrace.ReadOnlySpan{}
+  for _, span := range spans {
+    names[span.Name()] = span
+  }
+
+  root, ok := names["temperatureHandler"]
+  if !ok {
+    t.Fatalf("Expected a temperatureHandler span, got %v", names)
+  }
+
+  for _, name := range []string{"viacep.lookup", "weatherapi.current"} {
+    span, ok := names[name]
+    if !ok {
+      t.Errorf("Expected a %s span", name)
+      continue
+    }
+    if span.Parent().SpanID() != root.SpanContext().SpanID() {
+      t.Errorf("Expected %s to be a child of temperatureHandler", name)
+    }
+  }
+
+  for i, traceparent := range traceparents {
+    if traceparent == "" {
+      t.Errorf("Expected outbound request %d to carry a traceparent header", i)
+    }
+  }
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// temperatureUnit describes a supported scale: the code accepted in the units
+// query parameter, its name, the JSON field it is reported in and how to
+// convert to and from Celsius.
+type temperatureUnit struct {
+	Code        string
+	Name        string
+	Field       string
+	FromCelsius func(celsius float64) float64
+	ToCelsius   func(value float64) float64
+}
+
+func identity(value float64) float64 {
+	return value
+}
+
+var temperatureUnits = []temperatureUnit{
+	{Code: "c", Name: "celsius", Field: "temp_C", FromCelsius: identity, ToCelsius: identity},
+	{Code: "f", Name: "fahrenheit", Field: "temp_F", FromCelsius: celsiusToFahrenheit, ToCelsius: fahrenheitToCelsius},
+	{Code: "k", Name: "kelvin", Field: "temp_K", FromCelsius: celsiusToKelvin, ToCelsius: kelvinToCelsius},
+	{Code: "r", Name: "rankine", Field: "temp_R", FromCelsius: celsiusToRankine, ToCelsius: rankineToCelsius},
+}
+
+// temperatureUnitsFor returns temperatureUnits, with kelvin switched to the
+// legacy 273 offset unless kelvinPrecise; see KELVIN_PRECISE.
+func temperatureUnitsFor(kelvinPrecise bool) []temperatureUnit {
+	units := slices.Clone(temperatureUnits)
+	if kelvinPrecise {
+		return units
+	}
+	for i := range units {
+		if units[i].Code == "k" {
+			units[i].FromCelsius = legacyCelsiusToKelvin
+			units[i].ToCelsius = legacyKelvinToCelsius
+		}
+	}
+	return units
+}
+
+// UnitInfo describes a supported scale in the /units listing.
+type UnitInfo struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Field string `json:"field"`
+}
+
+// unitsHandler lists the scales in temperatureUnits, the same table the
+// responses are built from, so clients can discover codes and field names.
+func (s *Server) unitsHandler(w http.ResponseWriter, r *http.Request) {
+	units := make([]UnitInfo, 0, len(temperatureUnits))
+	for _, unit := range temperatureUnits {
+		units = append(units, UnitInfo{Code: unit.Code, Name: unit.Name, Field: unit.Field})
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(s.config.CacheMaxAge))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(units)
+}
+
+func findTemperatureUnit(code string) (temperatureUnit, bool) {
+	return findUnitIn(temperatureUnits, code)
+}
+
+// temperatureUnit is findTemperatureUnit with the server's KELVIN_PRECISE
+// conversions.
+func (s *Server) temperatureUnit(code string) (temperatureUnit, bool) {
+	return findUnitIn(s.units, code)
+}
+
+func findUnitIn(units []temperatureUnit, code string) (temperatureUnit, bool) {
+	for _, unit := range units {
+		if unit.Code == code {
+			return unit, true
+		}
+	}
+	return temperatureUnit{}, false
+}
+
+// parseUnits parses a comma-separated list of unit codes such as "c" or
+// "k,c". An empty value selects the default units.
+func (s *Server) parseUnits(value string) ([]temperatureUnit, error) {
+	if value == "" {
+		return s.defaultUnits(), nil
+	}
+	return parseUnitList(value)
+}
+
+func parseUnitList(value string) ([]temperatureUnit, error) {
+	var units []temperatureUnit
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(value, ",") {
+		unit, ok := findTemperatureUnit(strings.ToLower(strings.TrimSpace(code)))
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q", code)
+		}
+		if seen[unit.Code] {
+			return nil, fmt.Errorf("duplicate unit %q", code)
+		}
+		seen[unit.Code] = true
+		units = append(units, unit)
+	}
+
+	return units, nil
+}
+
+// defaultUnits returns the units and order reported when a request doesn't
+// choose them, set by TEMP_DEFAULT_UNITS.
+func (s *Server) defaultUnits() []temperatureUnit {
+	if len(s.config.DefaultUnits) == 0 {
+		return temperatureUnits
+	}
+	return s.config.DefaultUnits
+}
+
+// value returns the response's temperature in the given unit.
+func (t TemperatureResponse) value(unit temperatureUnit) float64 {
+	switch unit.Code {
+	case "f":
+		return t.TempF
+	case "k":
+		return t.TempK
+	case "r":
+		return t.TempR
+	}
+	return t.TempC
+}
+
+func (t TemperatureResponse) MarshalJSON() ([]byte, error) {
+	units := t.units
+	if len(units) == 0 {
+		units = temperatureUnits
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, unit := range units {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(t.value(unit))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%q:", unit.Field)
+		buf.Write(value)
+	}
+
+	details, err := json.Marshal(t.TemperatureDetails)
+	if err != nil {
+		return nil, err
+	}
+	if len(details) > 2 {
+		buf.WriteByte(',')
+		buf.Write(details[1 : len(details)-1])
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// temperatureXML is the XML shape of a TemperatureResponse: a <temperature>
+// element with the selected temp_* fields, then the details.
+type temperatureXML struct {
+	XMLName xml.Name `xml:"temperature"`
+	TempC   *float64 `xml:"temp_C,omitempty"`
+	TempF   *float64 `xml:"temp_F,omitempty"`
+	TempK   *float64 `xml:"temp_K,omitempty"`
+	TempR   *float64 `xml:"temp_R,omitempty"`
+	TemperatureDetails
+}
+
+// MarshalXML emits the same fields as MarshalJSON. Unlike JSON, XML keeps
+// the fields in declaration order rather than the order units lists them.
+func (t TemperatureResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	units := t.units
+	if len(units) == 0 {
+		units = temperatureUnits
+	}
+
+	out := temperatureXML{TemperatureDetails: t.TemperatureDetails}
+	for _, unit := range units {
+		value := t.value(unit)
+		switch unit.Code {
+		case "c":
+			out.TempC = &value
+		case "f":
+			out.TempF = &value
+		case "k":
+			out.TempK = &value
+		case "r":
+			out.TempR = &value
+		}
+	}
+	return e.Encode(out)
+}
+
+// text renders the selected units as a single line such as
+// "25.0C 77.0F 298.15K", or "2.5e+01C 7.7e+01F 2.9815e+02K" in scientific
+// notation.
+func (t TemperatureResponse) text() string {
+	units := t.units
+	if len(units) == 0 {
+		units = temperatureUnits
+	}
+
+	format := formatTemperature
+	if t.scientific {
+		format = formatTemperatureScientific
+	}
+
+	parts := make([]string, 0, len(units))
+	for _, unit := range units {
+		parts = append(parts, format(t.value(unit))+strings.ToUpper(unit.Code))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// formatTemperature prints value with at least one decimal, so whole
+// degrees read as "25.0" rather than "25".
+func formatTemperature(value float64) string {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// formatTemperatureScientific prints value in e notation with as many digits
+// as it takes to round-trip, so 298.15 reads as "2.9815e+02".
+func formatTemperatureScientific(value float64) string {
+	return strconv.FormatFloat(value, 'e', -1, 64)
+}
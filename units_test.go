@@ -0,0 +1,283 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+func TestParseUnits(t *testing.T) {
+  tests := []struct {
+    name     string
+    value    string
+    expected []string
+    wantErr  bool
+  }{
+    {"Default", "", []string{"c", "f", "k", "r"}, false},
+    {"Celsius", "c", []string{"c"}, false},
+    {"Uppercase", "F", []string{"f"}, false},
+    {"List", "k,c", []string{"k", "c"}, false},
+    {"Unknown", "x", nil, true},
+    {"Unknown In List", "c,x", nil, true},
+    {"Duplicate", "c,C", nil, true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      units, err := NewServer(testConfig(), nil).parseUnits(tt.value)
+      if (err != nil) != tt.wantErr {
+        t.Fatalf("parseUnits(%q) error = %v; wantErr %v", tt.value, err, tt.wantErr)
+      }
+      if len(units) != len(tt.expected) {
+        t.Fatalf("parseUnits(%q) returned %d units; want %d", tt.value, len(units), len(tt.expected))
+      }
+      for i, unit := range units {
+        if unit.Code != tt.expected[i] {
+          t.Errorf("parseUnits(%q)[%d] = %q; want %q", tt.value, i, unit.Code, tt.expected[i])
+        }
+      }
+    })
+  }
+}
+
+func TestDefaultUnits(t *testing.T) {
+  tests := []struct {
+    name     string
+    value    string
+    expected []string
+  }{
+    {"Unset", "", []string{"c", "f", "k", "r"}},
+    {"Reordered Subset", "k,c,f", []string{"k", "c", "f"}},
+    {"Invalid Token", "k,x", []string{"c", "f", "k", "r"}},
+    {"Duplicate", "k,k", []string{"c", "f", "k", "r"}},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      t.Setenv("TEMP_DEFAULT_UNITS", tt.value)
+      cfg, _ := LoadConfig()
+      s := NewServer(cfg, nil)
+
+      units := s.defaultUnits()
+      if len(units) != len(tt.expected) {
+        t.Fatalf("defaultUnits() returned %d units; want %d", len(units), len(tt.expected))
+      }
+      for i, unit := range units {
+        if unit.Code != tt.expected[i] {
+          t.Errorf("defaultUnits()[%d] = %q; want %q", i, unit.Code, tt.expected[i])
+        }
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerDefaultUnits(t *testing.T) {
+  tests := []struct {
+    name         string
+    defaultUnits string
+    query        string
+    expectedBody string
+  }{
+    {"Reordered Subset", "k,c,f", "cep=01001000", `{"temp_K":298.15,"temp_C":25,"temp_F":77,"city":"São Paulo"}` + "\n"},
+    {"Invalid Token", "k,x", "cep=01001000", `{"temp_C":25,"temp_F":77,"temp_K":298.15,"temp_R":536.67,"city":"São Paulo"}` + "\n"},
+    {"Query Overrides Default", "k,c,f", "cep=01001000&units=r", `{"temp_R":536.67,"city":"São Paulo"}` + "\n"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      t.Setenv("TEMP_DEFAULT_UNITS", tt.defaultUnits)
+      cfg := testConfig()
+      cfg.DefaultUnits = unitsFromEnv("TEMP_DEFAULT_UNITS", nil)
+      s := NewServer(cfg, mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+      req, err := http.NewRequest("GET", "/temperature?"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      if body := rr.Body.String(); body != tt.expectedBody {
+        t.Errorf("handler returned unexpected body: got %s want %s", body, tt.expectedBody)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerUnits(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, mockWeatherBody))
+
+  tests := []struct {
+    units    string
+    field    string
+    expected float64
+  }{
+    {"c", "temp_C", 25.0},
+    {"f", "temp_F", celsiusToFahrenheit(25.0)},
+    {"k", "temp_K", celsiusToKelvin(25.0)},
+    {"r", "temp_R", celsiusToRankine(25.0)},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.units, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000&units="+tt.units, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      var response map[string]interface{}
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      if response[tt.field] != tt.expected {
+        t.Errorf("Expected %s to be %v, got %v", tt.field, tt.expected, response[tt.field])
+      }
+
+      for _, unit := range temperatureUnits {
+        if unit.Field == tt.field {
+          continue
+        }
+        if _, ok := response[unit.Field]; ok {
+          t.Errorf("Expected %s to be omitted, got %s", unit.Field, rr.Body.String())
+        }
+      }
+
+      if response["city"] != "São Paulo" {
+        t.Errorf("Expected city to be 'São Paulo', got %v", response["city"])
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerUnitsWithExtended(t *testing.T) {
+  s := NewServer(testConfig(), mockUpstreamClient(mockViaCEPBody, `{"location": {"name": "São Paulo"}, "current": {"temp_c": 25.0, "feelslike_c": 27.0, "humidity": 62}}`))
+
+  tests := []struct {
+    name           string
+    query          string
+    wantFields     []string
+    wantConditions bool
+  }{
+    {"Units only", "&units=c", []string{"temp_C"}, false},
+    {"Extended only", "&extended=true", []string{"temp_C", "temp_F", "temp_K", "temp_R"}, true},
+    {"Units and extended", "&units=c&extended=true", []string{"temp_C"}, true},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req, err := http.NewRequest("GET", "/temperature?cep=01001000"+tt.query, nil)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      rr := httptest.NewRecorder()
+      http.HandlerFunc(s.temperatureHandler).ServeHTTP(rr, req)
+
+      if status := rr.Code; status != http.StatusOK {
+        t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+      }
+
+      var response map[string]interface{}
+      if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+        t.Fatalf("Failed to parse response body: %v", err)
+      }
+
+      var fields []string
+      for _, unit := range temperatureUnits {
+        if _, ok := response[unit.Field]; ok {
+          fields = append(fields, unit.Field)
+        }
+      }
+      if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+        t.Errorf("Expected temperature fields %v, got %s", tt.wantFields, rr.Body.String())
+      }
+
+      conditions, ok := response["conditions"].(map[string]interface{})
+      if ok != tt.wantConditions {
+        t.Fatalf("Expected conditions %v, got %s", tt.wantConditions, rr.Body.String())
+      }
+      if !tt.wantConditions {
+        return
+      }
+      if conditions["humidity"] != 62.0 || conditions["feels_like_C"] != 27.0 {
+        t.Errorf("Expected the full conditions object, got %v", conditions)
+      }
+      if _, ok := conditions["feels_like_F"]; !ok {
+        t.Errorf("Expected units not to filter the conditions, got %v", conditions)
+      }
+    })
+  }
+}
+
+func TestTemperatureHandlerInvalidUnits(t *testing.T) {
+  req, err := http.NewRequest("GET", "/temperature?cep=01001000&units=x", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  http.HandlerFunc(NewServer(defaultConfig(), nil).temperatureHandler).ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusUnprocessableEntity {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+  }
+
+  var response ErrorResponse
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Errorf("Failed to parse response body: %v", err)
+  }
+
+  expectedMessage := "units inválido"
+  if response.Message != expectedMessage {
+    t.Errorf("handler returned unexpected body: got %v want %v", response.Message, expectedMessage)
+  }
+}
+
+func TestUnitsHandler(t *testing.T) {
+  req, err := http.NewRequest("GET", "/units", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  NewServer(defaultConfig(), nil).routes().ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  var units []UnitInfo
+  if err := json.Unmarshal(rr.Body.Bytes(), &units); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  expected := []UnitInfo{
+    {Code: "c", Name: "celsius", Field: "temp_C"},
+    {Code: "f", Name: "fahrenheit", Field: "temp_F"},
+    {Code: "k", Name: "kelvin", Field: "temp_K"},
+    {Code: "r", Name: "rankine", Field: "temp_R"},
+  }
+  if len(units) != len(expected) {
+    t.Fatalf("Expected %d units, got %+v", len(expected), units)
+  }
+  for i := range expected {
+    if units[i] != expected[i] {
+      t.Errorf("unit %d: expected %+v, got %+v", i, expected[i], units[i])
+    }
+  }
+}
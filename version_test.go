@@ -0,0 +1,36 @@
+package main
+
+import (
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestVersionHandlerDefaults(t *testing.T) {
+  req, err := http.NewRequest("GET", "/version", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  rr := httptest.NewRecorder()
+  NewServer(defaultConfig(), nil).routes().ServeHTTP(rr, req)
+
+  if status := rr.Code; status != http.StatusOK {
+    t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+  }
+
+  if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+    t.Errorf("Expected Content-Type application/json, got %q", contentType)
+  }
+
+  var response VersionInfo
+  if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+    t.Fatalf("Failed to parse response body: %v", err)
+  }
+
+  expected := VersionInfo{Version: "dev", Commit: "unknown", BuildTime: "unknown"}
+  if response != expected {
+    t.Errorf("handler returned unexpected body: got %+v want %+v", response, expected)
+  }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// weatherAPIQuotaExceeded is the WeatherAPI error code for a key that has
+// used up its monthly calls.
+const weatherAPIQuotaExceeded = 2007
+
+var errMissingWeatherAPIKey = errors.New("WEATHER_API_KEY environment variable not set")
+
+// quotaExceeded reports whether the key used for the request is out of
+// calls, so another key may still succeed.
+func (e *WeatherAPIError) quotaExceeded() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.Code == weatherAPIQuotaExceeded
+}
+
+// doWeatherRequest calls the WeatherAPI endpoint at path with query, signing
+// it with the current of the configured keys and moving on to the next key while
+// WeatherAPI reports the quota as exceeded. It returns the 200 response for
+// the caller to decode and close, holding its upstream slot until the body
+// is closed; anything else is an *UpstreamError.
+func (s *Server) doWeatherRequest(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	apiKeys := s.config.WeatherAPIKeys
+	if len(apiKeys) == 0 {
+		return nil, errMissingWeatherAPIKey
+	}
+
+	release, err := s.upstreamSlots.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		cursor := s.weatherKeyCursor.Load()
+		query.Set("key", apiKeys[cursor%uint64(len(apiKeys))])
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.WeatherAPIBaseURL+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		prepareUpstreamRequest(ctx, req, s.config.UserAgent)
+
+		resp, err := doUpstream(providerWeatherAPI, s.client, s.retryJitter, req)
+		if err != nil {
+			recordUpstreamFailure(providerWeatherAPI)
+			return nil, &UpstreamError{Provider: providerWeatherAPI, Err: err}
+		}
+		if resp.StatusCode == http.StatusOK {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+			release = nil
+			return resp, nil
+		}
+
+		apiErr := newWeatherAPIError(resp, s.config.MaxUpstreamBodyBytes)
+		resp.Body.Close()
+		recordUpstreamFailure(providerWeatherAPI)
+
+		if !apiErr.quotaExceeded() || attempt >= len(apiKeys) {
+			return nil, &UpstreamError{Provider: providerWeatherAPI, Err: apiErr}
+		}
+
+		loggerFromContext(ctx).Warn("WeatherAPI key quota exceeded, switching to the next key", "key_index", cursor%uint64(len(apiKeys)))
+		s.weatherKeyCursor.CompareAndSwap(cursor, cursor+1)
+	}
+}
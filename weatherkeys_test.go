@@ -0,0 +1,103 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "testing"
+)
+
+const mockQuotaExceededBody = `{"error":{"code":2007,"message":"API key has exceeded calls per month quota."}}`
+
+func TestGetTemperatureFromLocationRotatesKeys(t *testing.T) {
+  tests := []struct {
+    name   string
+    status int
+    body   string
+  }{
+    {"Too Many Requests", http.StatusTooManyRequests, `{}`},
+    {"Quota Exceeded", http.StatusForbidden, mockQuotaExceededBody},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      var usedKeys []string
+      mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+        key := req.URL.Query().Get("key")
+        usedKeys = append(usedKeys, key)
+        if key == "key-a" {
+          return mockResponse(tt.status, tt.body), nil
+        }
+        return mockResponse(http.StatusOK, mockWeatherBody), nil
+      })
+
+      s := serverWithKeys([]string{"key-a", "key-b"}, mockClient)
+      if _, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", ""); err != nil {
+        t.Fatalf("Expected the second key to succeed, got %v", err)
+      }
+
+      // The exhausted key is skipped from then on
+      if _, err := s.getTemperatureFromLocation(context.Background(), "São Paulo", ""); err != nil {
+        t.Fatalf("Expected no error, got %v", err)
+      }
+
+      expected := []string{"key-a", "key-b", "key-b"}
+      if len(usedKeys) != len(expected) {
+        t.Fatalf("Expected keys %v to be used, got %v", expected, usedKeys)
+      }
+      for i := range expected {
+        if usedKeys[i] != expected[i] {
+          t.Errorf("Expected keys %v to be used, got %v", expected, usedKeys)
+          break
+        }
+      }
+    })
+  }
+}
+
+func TestGetTemperatureFromLocationAllKeysExhausted(t *testing.T) {
+  calls := 0
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    calls++
+    return mockResponse(http.StatusTooManyRequests, `{}`), nil
+  })
+
+  _, err := serverWithKeys([]string{"key-a", "key-b"}, mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", "")
+  if !errors.Is(err, ErrWeatherUnavailable) {
+    t.Errorf("Expected ErrWeatherUnavailable, got %v", err)
+  }
+
+  if calls != 2 {
+    t.Errorf("Expected each key to be tried once, got %d calls", calls)
+  }
+}
+
+func TestGetTemperatureFromLocationSingleKey(t *testing.T) {
+  var usedKeys []string
+  mockClient := setupMockHTTPClient(func(req *http.Request) (*http.Response, error) {
+    usedKeys = append(usedKeys, req.URL.Query().Get("key"))
+    return mockResponse(http.StatusTooManyRequests, `{}`), nil
+  })
+
+  if _, err := serverWithKeys([]string{"only-key"}, mockClient).getTemperatureFromLocation(context.Background(), "São Paulo", ""); err == nil {
+    t.Fatal("Expected error, got nil")
+  }
+
+  if len(usedKeys) != 1 || usedKeys[0] != "only-key" {
+    t.Errorf("Expected a single call with the only key, got %v", usedKeys)
+  }
+}
+
+func TestLoadConfigSingleWeatherAPIKey(t *testing.T) {
+  clearConfigEnv(t)
+  t.Setenv("WEATHER_API_KEY", "legacy-key")
+
+  cfg, err := LoadConfig()
+  if err != nil {
+    t.Fatalf("Expected no error, got %v", err)
+  }
+
+  if len(cfg.WeatherAPIKeys) != 1 || cfg.WeatherAPIKeys[0] != "legacy-key" {
+    t.Errorf("Expected WEATHER_API_KEY to be used, got %v", cfg.WeatherAPIKeys)
+  }
+}